@@ -0,0 +1,289 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/allocator/postgres"
+	"go-dovecot-director/pkg/director"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/mailbox/postfixadmin"
+	"go-dovecot-director/pkg/password"
+)
+
+// errNoMapping is returned for users without a stored backend, as the
+// checkpassword subcommand can not allocate one
+var errNoMapping = errors.New("user has no backend mapping, allocation needs a running director")
+
+// checkpassword exit codes
+const (
+	checkpasswordFailure   = 1
+	checkpasswordError     = 2
+	checkpasswordTemporary = 111
+)
+
+// checkpassword implements Dovecot's checkpassword protocol. Username and
+// password are read from fd 3, and on success the reply program given in
+// args is executed with the proxy fields in its environment.
+func checkpassword(args []string) int {
+	if len(args) == 0 {
+		log.Print("checkpassword: missing reply program")
+
+		return checkpasswordError
+	}
+
+	input, err := io.ReadAll(io.LimitReader(os.NewFile(3, "checkpassword"), 512))
+	if err != nil {
+		log.Printf("checkpassword: %+v", err)
+
+		return checkpasswordError
+	}
+
+	// input is username\0password\0timestamp\0
+	fields := strings.Split(string(input), "\x00")
+	if len(fields) < 2 || fields[0] == "" {
+		log.Print("checkpassword: invalid input")
+
+		return checkpasswordError
+	}
+
+	request := &dovecot.Request{Password: fields[1]}
+	request.SetUser(fields[0])
+
+	for key, env := range map[string]string{
+		"service":     "SERVICE",
+		"lip":         "TCPLOCALIP",
+		"lport":       "TCPLOCALPORT",
+		"rip":         "TCPREMOTEIP",
+		"rport":       "TCPREMOTEPORT",
+		"master_user": "MASTER_USER",
+	} {
+		if err = request.Set(key, os.Getenv(env)); err != nil {
+			log.Printf("checkpassword: %+v", err)
+
+			return checkpasswordError
+		}
+	}
+
+	chain, err := chainConfig()
+	if err != nil {
+		log.Printf("checkpassword: %+v", err)
+
+		return checkpasswordError
+	}
+
+	normalize := normalizeConfig()
+	if err = normalize.Normalize(request); err != nil {
+		log.Printf("checkpassword: %+v", err)
+
+		return checkpasswordFailure
+	}
+
+	if err = request.Validate(); err != nil {
+		log.Printf("checkpassword: %+v", err)
+
+		return checkpasswordFailure
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var attrs *dovecot.ResponseAttributes
+	if *directorUrl != "" {
+		attrs, err = checkpasswordQueryDirector(ctx, request)
+	} else {
+		attrs, err = checkpasswordQueryStore(ctx, request, chain)
+	}
+
+	if err != nil {
+		log.Printf("checkpassword: %+v", err)
+
+		return checkpasswordTemporary
+	}
+
+	if attrs == nil {
+		return checkpasswordFailure
+	}
+
+	attrFields, err := attrs.Fields()
+	if err != nil {
+		log.Printf("checkpassword: %+v", err)
+
+		return checkpasswordError
+	}
+
+	// passdb fields are used for proxying, userdb_ prefixed copies serve
+	// userdb lookups
+	env := append(os.Environ(), "USER="+request.User)
+	var extra []string
+	for _, field := range attrFields {
+		key, value, _ := strings.Cut(field, "=")
+
+		env = append(env, key+"="+value, "userdb_"+key+"="+value)
+		extra = append(extra, key, "userdb_"+key)
+	}
+	env = append(env, "EXTRA="+strings.Join(extra, " "))
+
+	err = syscall.Exec(args[0], args, env)
+	log.Printf("checkpassword: %+v", err)
+
+	return checkpasswordError
+}
+
+// checkpasswordQueryDirector asks a running director for the backend, a nil
+// result means authentication failure
+func checkpasswordQueryDirector(ctx context.Context, request *dovecot.Request) (*dovecot.ResponseAttributes, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(*directorUrl, "/")+"/auth_passdb_lookup", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-type", "application/json")
+	if *apiToken != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+*apiToken)
+	}
+
+	httpResponse, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid http status received: %d", httpResponse.StatusCode)
+	}
+
+	var response dovecot.PassdbResponse
+	if err = json.NewDecoder(io.LimitReader(httpResponse.Body, 1<<20)).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	switch response.Code {
+	case dovecot.PASSDB_RESULT_OK:
+	case dovecot.PASSDB_RESULT_NEXT:
+		// the following passdbs would authenticate the user, checkpassword
+		// can not pass it on
+		return nil, nil
+	case dovecot.PASSDB_RESULT_INTERNAL_FAILURE:
+		if response.Attributes != nil {
+			return nil, fmt.Errorf("director failure: %s", response.Attributes.Reason)
+		}
+
+		return nil, fmt.Errorf("director failure")
+	default:
+		return nil, nil
+	}
+
+	return response.Attributes, nil
+}
+
+// checkpasswordQueryStore reads the stored backend of the user from the
+// database, users without a mapping fail temporarily. Backends are not
+// checked for being alive. Passwords and the status of the mailbox are
+// checked when enabled. Users left to the following passdbs of chain fail.
+func checkpasswordQueryStore(ctx context.Context, request *dovecot.Request, chain director.ChainConfig) (*dovecot.ResponseAttributes, error) {
+	// the following passdbs would authenticate the user
+	if chain.Next {
+		return nil, nil
+	}
+
+	db, err := newDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if *resolveAliasDomains || *resolveAliases {
+		user, err := postfixadmin.NewResolver(db, *resolveAliases).Resolve(ctx, request.User)
+		if err != nil {
+			return nil, err
+		}
+
+		request.SetUser(user)
+	}
+
+	if !chain.Owns(request.Domain) {
+		return nil, nil
+	}
+
+	if *verifyPassword || *checkStatus {
+		m, err := postfixadmin.New(db).Get(ctx, request.User)
+		if errors.Is(err, mailbox.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if *checkStatus && (!m.Active || !m.DomainActive) {
+			return nil, nil
+		}
+
+		if *verifyPassword {
+			if ok, err := password.Verify(request.Password, m.Password); !ok {
+				return nil, err
+			}
+		}
+	}
+
+	store := postgres.New(db, nil).(allocator.Store)
+
+	backend, err := store.Lookup(ctx, request.User)
+	if err != nil {
+		return nil, err
+	}
+	if backend == "" {
+		return nil, errNoMapping
+	}
+
+	return &dovecot.ResponseAttributes{
+		Nopassword: true,
+		Proxy:      true,
+		Host:       backend,
+	}, nil
+}
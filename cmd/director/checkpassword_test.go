@@ -0,0 +1,122 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-dovecot-director/pkg/director"
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestCheckpasswordQueryDirector(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response dovecot.PassdbResponse
+		host     string
+		err      bool
+	}{
+		{
+			name:     "ok",
+			status:   http.StatusOK,
+			response: dovecot.PassdbResponse{Code: dovecot.PASSDB_RESULT_OK, Attributes: &dovecot.ResponseAttributes{Proxy: true, Host: "10.0.0.1"}},
+			host:     "10.0.0.1",
+		},
+		{
+			name:     "password mismatch",
+			status:   http.StatusOK,
+			response: dovecot.PassdbResponse{Code: dovecot.PASSDB_RESULT_PASSWORD_MISMATCH, Attributes: &dovecot.ResponseAttributes{Reason: "password mismatch"}},
+		},
+		{
+			name:     "next",
+			status:   http.StatusOK,
+			response: dovecot.PassdbResponse{Code: dovecot.PASSDB_RESULT_NEXT, Attributes: &dovecot.ResponseAttributes{Proxy: true, Host: "10.0.0.1"}},
+		},
+		{
+			name:     "internal failure",
+			status:   http.StatusOK,
+			response: dovecot.PassdbResponse{Code: dovecot.PASSDB_RESULT_INTERNAL_FAILURE, Attributes: &dovecot.ResponseAttributes{Reason: "no backends"}},
+			err:      true,
+		},
+		{
+			name:   "http failure",
+			status: http.StatusInternalServerError,
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/auth_passdb_lookup" || r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusUnauthorized)
+
+					return
+				}
+
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(tt.response)
+			}))
+			defer server.Close()
+
+			*directorUrl = server.URL
+			*apiToken = "token"
+
+			attrs, err := checkpasswordQueryDirector(context.Background(), &dovecot.Request{User: "user@example.com"})
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+
+			host := ""
+			if attrs != nil {
+				host = attrs.Host
+			}
+			if host != tt.host {
+				t.Errorf("host = %q, want %q", host, tt.host)
+			}
+		})
+	}
+}
+
+func TestCheckpasswordQueryStoreNext(t *testing.T) {
+	request := &dovecot.Request{}
+	request.SetUser("user@example.com")
+
+	// no database is needed, the following passdbs authenticate the user
+	attrs, err := checkpasswordQueryStore(context.Background(), request, director.ChainConfig{Next: true})
+	if attrs != nil || err != nil {
+		t.Errorf("got %+v, %v", attrs, err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go-dovecot-director/pkg/director"
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// attributesConfig is the format of the proxy attributes file
+type attributesConfig struct {
+	// Default attributes returned for all backends
+	Default dovecot.ProxyAttributes `json:"default"`
+
+	// Backends holds overrides for individual backends
+	Backends map[string]dovecot.ProxyAttributes `json:"backends"`
+
+	// Services holds routing settings of Dovecot services
+	Services map[string]serviceConfig `json:"services"`
+
+	// Userdb enables userdb responses built from mailboxes
+	Userdb *userdbConfig `json:"userdb"`
+}
+
+// userdbTemplates are the userdb fields returned for mailboxes
+type userdbTemplates struct {
+	UID  string `json:"uid"`
+	GID  string `json:"gid"`
+	Home string `json:"home"`
+	Mail string `json:"mail"`
+}
+
+// userdbConfig holds the userdb templates for all backends, and overrides
+// for individual ones
+type userdbConfig struct {
+	userdbTemplates
+
+	Backends map[string]userdbTemplates `json:"backends"`
+}
+
+// templates returns the default and per backend templates for the director
+func (c *userdbConfig) templates() (director.UserdbTemplates, map[string]director.UserdbTemplates) {
+	backends := make(map[string]director.UserdbTemplates, len(c.Backends))
+	for backend, t := range c.Backends {
+		backends[backend] = director.UserdbTemplates(t)
+	}
+
+	return director.UserdbTemplates(c.userdbTemplates), backends
+}
+
+// serviceConfig configures routing of a Dovecot service
+type serviceConfig struct {
+	// Attributes override the backend attributes for the service
+	Attributes dovecot.ProxyAttributes `json:"attributes"`
+
+	// KubernetesService is an optional separate service of the backend PODs
+	// serving the protocol
+	KubernetesService string `json:"kubernetes_service"`
+}
+
+// loadAttributesConfig reads and validates a proxy attributes file, an empty
+// path results in an empty configuration
+func loadAttributesConfig(path string) (*attributesConfig, error) {
+	config := &attributesConfig{}
+
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err = config.Default.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: default: %w", path, err)
+	}
+
+	for backend, attrs := range config.Backends {
+		if err = attrs.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: backend %s: %w", path, backend, err)
+		}
+	}
+
+	for service, sc := range config.Services {
+		if err = sc.Attributes.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: service %s: %w", path, service, err)
+		}
+	}
+
+	return config, nil
+}
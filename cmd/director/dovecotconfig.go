@@ -0,0 +1,96 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/namsral/flag"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// dovecotConfig writes the generated Lua script or Dovecot configuration
+// named in args to stdout
+func dovecotConfig(args []string) int {
+	fs := flag.NewFlagSet("dovecot-config", flag.ContinueOnError)
+	version := fs.String("version", "2.3", "Dovecot version of the proxies, 2.3 or 2.4")
+	url := fs.String("url", "http://go-dovecot-director:8080", "Director URL queried by the Lua script")
+	token := fs.String("token", "", "Bearer token sent by the Lua script")
+	luaFile := fs.String("lua-file", "/etc/dovecot/proxy.lua", "Path of the Lua script in the Dovecot configuration")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	v, err := dovecot.ParseVersion(*version)
+	if err != nil {
+		log.Printf("dovecot-config: %+v", err)
+
+		return 2
+	}
+
+	name := "proxy.lua"
+	if fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+
+	config := dovecot.ScriptConfig{
+		URL:     *url,
+		Token:   *token,
+		LuaFile: *luaFile,
+		Version: v,
+	}
+	if err = config.Validate(); err != nil {
+		log.Printf("dovecot-config: %+v", err)
+
+		return 2
+	}
+
+	switch name {
+	case "proxy.lua":
+		err = dovecot.WriteLua(os.Stdout, config)
+	case "dovecot.conf":
+		err = dovecot.WriteConf(os.Stdout, config)
+	default:
+		log.Printf("dovecot-config: unknown file %q, proxy.lua or dovecot.conf", name)
+
+		return 2
+	}
+
+	if err != nil {
+		log.Printf("dovecot-config: %+v", err)
+
+		return 1
+	}
+
+	return 0
+}
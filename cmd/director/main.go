@@ -34,9 +34,12 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -51,6 +54,10 @@ import (
 
 	"go-dovecot-director/pkg/allocator/postgres"
 	"go-dovecot-director/pkg/director"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox/postfixadmin"
+	opostgres "go-dovecot-director/pkg/overrides/postgres"
+	"go-dovecot-director/pkg/passwdfile"
 	kpool "go-dovecot-director/pkg/pool/kubernetes"
 )
 
@@ -65,15 +72,71 @@ var (
 	namespace = flag.String("namespace", "", "Namespace of services to watch")
 	service   = flag.String("service", "", "Service for backend PODs")
 
-	directorListenAddress = flag.String("director-listen-address", ":8080", "Listen address for director requests")
+	directorListenAddress   = flag.String("director-listen-address", ":8080", "Listen address for director requests")
+	publicUrl               = flag.String("public-url", "", "Director URL in the served Lua script, the host of the request if empty")
+	apiToken                = flag.String("api-token", "", "Bearer token required on director HTTP requests, empty disables")
+	authClientListenAddress = flag.String("auth-client-listen-address", "", "Listen address for Dovecot auth-client protocol requests, unix:<path> for a unix socket")
+	authMasterListenAddress = flag.String("auth-master-listen-address", "", "Listen address for Dovecot auth-master protocol requests, unix:<path> for a unix socket")
+	socketmapListenAddress  = flag.String("socketmap-listen-address", "", "Listen address for Postfix socketmap transport lookups, unix:<path> for a unix socket")
+	tcpTableListenAddress   = flag.String("tcp-table-listen-address", "", "Listen address for Postfix tcp_table transport lookups, unix:<path> for a unix socket")
+	dictListenAddress       = flag.String("dict-listen-address", "", "Listen address for Dovecot dict protocol requests, unix:<path> for a unix socket")
+	adminListenAddress      = flag.String("admin-listen-address", "", "Listen address for the management API, empty disables")
+	adminToken              = flag.String("admin-token", "", "Bearer token required on the management API, changes are refused without it")
+
+	normalizeTrim      = flag.Bool("normalize-trim", false, "Trim white space around user names before allocating a backend")
+	normalizeLowercase = flag.Bool("normalize-lowercase", false, "Fold user names to lower case before allocating a backend")
+	normalizeIDNA      = flag.Bool("normalize-idna", false, "Convert internationalized domains of user names to punycode before allocating a backend")
+	recipientDelimiter = flag.String("recipient-delimiter", "", "Characters starting an address extension stripped from user names, e.g. +")
+	defaultDomain      = flag.String("default-domain", "", "Domain appended to user names without one")
+
+	lmtpPort   = flag.Int("lmtp-port", 24, "Backend LMTP port used in Postfix transports")
+	nginxPorts = flag.String("nginx-ports", "", "Comma separated protocol=port pairs of backend ports returned to nginx, e.g. smtp=25, defaults to imap=143,pop3=110,smtp=587")
+	routingKey = flag.String("routing-key", "%{user}", "Template of the name backends are allocated for, e.g. %{username} or %{orig_user}")
+	proxyMode  = flag.String("proxy-mode", "always", "Proxy mode: always, maybe for proxy_maybe, or local to serve requests received on the backend itself locally, the latter two need --verify-password or --passdb-next")
+
+	dovecotVersion  = flag.String("dovecot-version", "2.3", "Dovecot version of the proxies, 2.3 or 2.4")
+	proxyAttributes = flag.String("proxy-attributes", "", "Path of a json file with proxy attributes returned globally, per backend and per service")
+
+	passdbNext        = flag.Bool("passdb-next", false, "Answer successful passdb lookups with NEXT and the proxy fields, leaving authentication to the following passdbs")
+	passdbNextUnknown = flag.Bool("passdb-next-unknown", false, "Answer passdb lookups of unknown users with NEXT instead of USER_UNKNOWN")
+	ownedDomains      = flag.String("owned-domains", "", "Comma separated domains handled by the director, passdb lookups of others are answered with NEXT, empty handles all")
+
+	referralServices = flag.String("referral-services", "", "Comma separated services receiving login referrals instead of proxying, e.g. imap")
+	referralNetworks = flag.String("referral-networks", "", "Comma separated client networks receiving login referrals instead of proxying, of imap unless --referral-services is set")
+	referralHosts    = flag.String("referral-hosts", "", "Comma separated backend=host pairs of host names clients are referred to")
+
+	policyWindow          = flag.Duration("policy-window", 10*time.Minute, "Period in which auth policy failures are counted")
+	policyIPMaxFailures   = flag.Int("policy-ip-max-failures", 0, "Reject remote addresses after this many failed logins, 0 disables")
+	policyUserMaxFailures = flag.Int("policy-user-max-failures", 0, "Reject users after this many failed logins, 0 disables")
+	policyDelay           = flag.Duration("policy-delay", time.Second, "Login delay imposed for each failed login")
 
 	databaseHost     = flag.String("database-host", "postgres", "Postfixadmin database hostname")
 	databasePort     = flag.Int("database-port", 5432, "Postfixadmin database port")
 	databaseName     = flag.String("database-name", "postfixadmin", "Postfixadmin database name")
 	databaseUser     = flag.String("database-user", "postfixadmin", "Postfixadmin database username")
 	databasePassword = flag.String("database-password", "postfixadmin", "Postfixadmin database password")
+
+	passwdFile         = flag.String("passwd-file", "", "Path of a Dovecot passwd-file to export proxy destinations to, empty disables")
+	passwdFileInterval = flag.Duration("passwd-file-interval", time.Minute, "Interval of resyncing the passwd-file export besides change notifications")
+
+	verifyPassword      = flag.Bool("verify-password", false, "Verify passwords against the Postfixadmin mailbox hashes before proxying")
+	checkStatus         = flag.Bool("check-status", false, "Reject users of inactive Postfixadmin mailboxes and domains before allocating a backend")
+	resolveAliasDomains = flag.Bool("resolve-alias-domains", false, "Route addresses of Postfixadmin alias domains on the mailboxes of their target domains")
+	resolveAliases      = flag.Bool("resolve-aliases", false, "Route Postfixadmin aliases with a single mailbox target on that mailbox, implies resolve-alias-domains")
+	useOverrides        = flag.Bool("overrides", false, "Merge extra field overrides of the director_overrides table into responses")
+
+	directorUrl = flag.String("director-url", "", "Director URL queried by the checkpassword subcommand, the database is used directly if empty")
 )
 
+func newDatabase() (*pgxpool.Pool, error) {
+	return pgxpool.New(context.TODO(),
+		fmt.Sprintf(
+			"host=%s port=%d database=%s user=%s password=%s sslmode=disable pool_max_conns=2",
+			*databaseHost, *databasePort, *databaseName, *databaseUser, *databasePassword,
+		),
+	)
+}
+
 func newClientSet() (*kubernetes.Clientset, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -87,20 +150,192 @@ func newClientSet() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+// splitList splits a comma separated list, dropping empty items
+func splitList(list string) []string {
+	var items []string
+
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func newReferralConfig() (config director.ReferralConfig, err error) {
+	config.Services = splitList(*referralServices)
+
+	for _, network := range splitList(*referralNetworks) {
+		var prefix netip.Prefix
+		if prefix, err = netip.ParsePrefix(network); err != nil {
+			return
+		}
+
+		config.Networks = append(config.Networks, prefix)
+	}
+
+	config.Hosts = make(map[string]string)
+	for _, pair := range splitList(*referralHosts) {
+		backend, host, found := strings.Cut(pair, "=")
+		if !found {
+			err = fmt.Errorf("invalid referral host: %q", pair)
+
+			return
+		}
+
+		config.Hosts[backend] = host
+	}
+
+	return
+}
+
+// parseNginxPorts parses the protocol=port pairs of --nginx-ports
+func parseNginxPorts() (map[string]int, error) {
+	ports := make(map[string]int)
+
+	for _, pair := range splitList(*nginxPorts) {
+		protocol, value, found := strings.Cut(pair, "=")
+		port, err := strconv.Atoi(value)
+		if !found || err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid nginx port: %q", pair)
+		}
+
+		ports[protocol] = port
+	}
+
+	return ports, nil
+}
+
+// parseProxyMode parses --proxy-mode, refusing the modes serving users
+// locally unless their passwords are verified
+func parseProxyMode() (director.ProxyMode, error) {
+	mode, err := director.ParseProxyMode(*proxyMode)
+	if err != nil {
+		return mode, err
+	}
+
+	if mode != director.ProxyAlways && !*verifyPassword && !*passdbNext {
+		return mode, fmt.Errorf("proxy mode %s needs --verify-password or --passdb-next", *proxyMode)
+	}
+
+	return mode, nil
+}
+
+// listen listens on a tcp address, or on a unix socket given as unix:<path>
+func listen(address string) (net.Listener, error) {
+	if path, found := strings.CutPrefix(address, "unix:"); found {
+		os.Remove(path)
+
+		return net.Listen("unix", path)
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// chainConfig returns how the director takes part in a passdb chain. With
+// --passdb-next the following passdbs verify passwords, so it excludes
+// --verify-password.
+func chainConfig() (director.ChainConfig, error) {
+	if *passdbNext && *verifyPassword {
+		return director.ChainConfig{}, fmt.Errorf("--passdb-next can not be used with --verify-password")
+	}
+
+	return director.ChainConfig{
+		Next:        *passdbNext,
+		Domains:     splitList(*ownedDomains),
+		NextUnknown: *passdbNextUnknown,
+	}, nil
+}
+
+// normalizeConfig returns the user name normalization steps enabled
+func normalizeConfig() director.NormalizeConfig {
+	return director.NormalizeConfig{
+		TrimSpace:          *normalizeTrim,
+		Lowercase:          *normalizeLowercase,
+		IDNA:               *normalizeIDNA,
+		RecipientDelimiter: *recipientDelimiter,
+		DefaultDomain:      *defaultDomain,
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "checkpassword" {
+		flag.CommandLine.Parse(os.Args[2:])
+
+		os.Exit(checkpassword(flag.Args()))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "dovecot-config" {
+		os.Exit(dovecotConfig(os.Args[2:]))
+	}
+
 	flag.Parse()
 
-	directorListener, err := net.Listen("tcp", *directorListenAddress)
+	mode, err := parseProxyMode()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	db, err := pgxpool.New(context.TODO(),
-		fmt.Sprintf(
-			"host=%s port=%d database=%s user=%s password=%s sslmode=disable pool_max_conns=2",
-			*databaseHost, *databasePort, *databaseName, *databaseUser, *databasePassword,
-		),
-	)
+	chain, err := chainConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	routingTemplate, err := dovecot.ParseTemplate(*routingKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ports, err := parseNginxPorts()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	referral, err := newReferralConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	version, err := dovecot.ParseVersion(*dovecotVersion)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	attributes, err := loadAttributesConfig(*proxyAttributes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	directorListener, err := listen(*directorListenAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// optional listeners for native protocols and management
+	protocolListeners := []struct {
+		address  string
+		serve    func(*director.Director, context.Context, net.Listener) error
+		listener net.Listener
+	}{
+		{address: *authClientListenAddress, serve: (*director.Director).ServeAuthClient},
+		{address: *authMasterListenAddress, serve: (*director.Director).ServeAuthMaster},
+		{address: *socketmapListenAddress, serve: (*director.Director).ServeSocketmap},
+		{address: *tcpTableListenAddress, serve: (*director.Director).ServeTCPTable},
+		{address: *dictListenAddress, serve: (*director.Director).ServeDict},
+		{address: *adminListenAddress, serve: (*director.Director).ServeAdmin},
+	}
+	for i := range protocolListeners {
+		if protocolListeners[i].address == "" {
+			continue
+		}
+
+		if protocolListeners[i].listener, err = listen(protocolListeners[i].address); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	db, err := newDatabase()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -115,8 +350,67 @@ func main() {
 		log.Fatal(err)
 	}
 
+	options := []director.Option{
+		director.WithPool(pool),
+		director.WithMailboxes(postfixadmin.New(db)),
+		director.WithPasswordVerification(*verifyPassword),
+		director.WithStatusCheck(*checkStatus),
+		director.WithRoutingKey(routingTemplate),
+		director.WithNormalization(normalizeConfig()),
+		director.WithLMTPPort(*lmtpPort),
+		director.WithNginxPorts(ports),
+		director.WithProxyMode(mode),
+		director.WithReferral(referral),
+		director.WithChaining(chain),
+		director.WithDovecotVersion(version),
+		director.WithPublicURL(*publicUrl),
+		director.WithToken(*apiToken),
+		director.WithAdminToken(*adminToken),
+		director.WithProxyAttributes(attributes.Default, attributes.Backends),
+		director.WithPolicy(director.PolicyConfig{
+			Window:          *policyWindow,
+			MaxIPFailures:   *policyIPMaxFailures,
+			MaxUserFailures: *policyUserMaxFailures,
+			Delay:           *policyDelay,
+		}),
+	}
+
+	if *resolveAliasDomains || *resolveAliases {
+		options = append(options, director.WithResolver(postfixadmin.NewResolver(db, *resolveAliases)))
+	}
+
+	if *useOverrides {
+		options = append(options, director.WithOverrides(opostgres.New(db)))
+	}
+
+	if attributes.Userdb != nil {
+		options = append(options, director.WithUserdb(attributes.Userdb.templates()))
+	}
+
+	// services may be monitored by separate pools
+	services := make(map[string]director.ServiceConfig)
+	for name, sc := range attributes.Services {
+		config := director.ServiceConfig{Attributes: sc.Attributes}
+
+		if sc.KubernetesService != "" {
+			if config.Pool, err = kpool.New(client, *namespace, sc.KubernetesService); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		services[name] = config
+		options = append(options, director.WithService(name, config))
+	}
+
 	allocator := postgres.New(db, pool)
-	dir := director.New(allocator)
+	dir := director.New(allocator, options...)
+
+	var exporter *passwdfile.Exporter
+	if *passwdFile != "" {
+		if exporter, err = passwdfile.New(allocator, pool, *passwdFile, *passwdFileInterval); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -131,6 +425,19 @@ func main() {
 		pool.Run(ctx)
 	}()
 
+	for _, sc := range services {
+		if sc.Pool == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sc.Pool.Run(ctx)
+		}()
+	}
+
 	// start dovecot server
 	wg.Add(1)
 	go func() {
@@ -139,6 +446,30 @@ func main() {
 		dir.Serve(ctx, directorListener)
 	}()
 
+	// start passwd-file exporter
+	if exporter != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			exporter.Run(ctx)
+		}()
+	}
+
+	// start native protocol and management servers
+	for _, pl := range protocolListeners {
+		if pl.listener == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pl.serve(dir, ctx, pl.listener)
+		}()
+	}
+
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGTERM, syscall.SIGINT)
 	<-sigchan
@@ -0,0 +1,110 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package main
+
+import "testing"
+
+func TestParseProxyMode(t *testing.T) {
+	tests := []struct {
+		mode   string
+		verify bool
+		next   bool
+		err    bool
+	}{
+		{mode: "always"},
+		{mode: "maybe", err: true},
+		{mode: "maybe", verify: true},
+		{mode: "maybe", next: true},
+		{mode: "local", err: true},
+		{mode: "local", verify: true},
+		{mode: "local", next: true},
+		{mode: "never", verify: true, err: true},
+	}
+
+	defer func(mode string, verify, next bool) {
+		*proxyMode, *verifyPassword, *passdbNext = mode, verify, next
+	}(*proxyMode, *verifyPassword, *passdbNext)
+
+	for _, tt := range tests {
+		*proxyMode, *verifyPassword, *passdbNext = tt.mode, tt.verify, tt.next
+
+		if _, err := parseProxyMode(); (err != nil) != tt.err {
+			t.Errorf("%s verify=%v next=%v: err = %v", tt.mode, tt.verify, tt.next, err)
+		}
+	}
+}
+
+func TestDovecotConfig(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{args: []string{"--version", "2.5"}, code: 2},
+		{args: []string{"--lua-file", "proxy.lua", "dovecot.conf"}, code: 2},
+		{args: []string{"--lua-file", "/etc/proxy.lua blocking=no", "dovecot.conf"}, code: 2},
+		{args: []string{"--lua-file", "/etc/proxy.lua\n}", "dovecot.conf"}, code: 2},
+		{args: []string{"dovecot-ldap.conf"}, code: 2},
+	}
+
+	for _, tt := range tests {
+		if code := dovecotConfig(tt.args); code != tt.code {
+			t.Errorf("%q: exit code %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestChainConfig(t *testing.T) {
+	tests := []struct {
+		next   bool
+		verify bool
+		err    bool
+	}{
+		{},
+		{next: true},
+		{verify: true},
+		{next: true, verify: true, err: true},
+	}
+
+	defer func(next, verify bool) {
+		*passdbNext, *verifyPassword = next, verify
+	}(*passdbNext, *verifyPassword)
+
+	for _, tt := range tests {
+		*passdbNext, *verifyPassword = tt.next, tt.verify
+
+		chain, err := chainConfig()
+		if (err != nil) != tt.err {
+			t.Errorf("next=%v verify=%v: err = %v", tt.next, tt.verify, err)
+		}
+		if err == nil && chain.Next != tt.next {
+			t.Errorf("next=%v verify=%v: got next %v", tt.next, tt.verify, chain.Next)
+		}
+	}
+}
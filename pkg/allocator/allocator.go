@@ -29,10 +29,60 @@ SUCH DAMAGE.
 
 package allocator
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// Errors returned by allocators, possibly wrapping the underlying error
+var (
+	// ErrUserUnknown is returned for users without a mailbox
+	ErrUserUnknown = errors.New("user unknown")
+
+	// ErrTemporary is returned for failures which may go away on retry
+	ErrTemporary = errors.New("temporary failure")
+
+	// ErrNoBackends is returned when no backend is available
+	ErrNoBackends = errors.New("no backends are available")
+
+	// ErrInternal is returned for failures not expected to go away
+	ErrInternal = errors.New("internal error")
+)
 
 // Allocator holds logic for assigning a consistent allocation for user
 type Allocator interface {
-	// Allocate returns deterministic allocation for a user
+	// Allocate returns deterministic allocation for a user, or one of the
+	// allocator errors
 	Allocate(context.Context, string) (string, error)
 }
+
+// Mapping is an allocation of a user to a backend
+type Mapping struct {
+	Username string
+	Backend  string
+}
+
+// Filter restricts enumerated allocations, empty fields match everything
+type Filter struct {
+	Backend string
+	Domain  string
+}
+
+// Store is implemented by allocators able to enumerate their allocations
+type Store interface {
+	// Lookup returns the stored backend of a user without allocating one,
+	// or an empty string if there is none
+	Lookup(context.Context, string) (string, error)
+
+	// Iterate calls fn for each allocation matching the filter, stopping at
+	// the first error
+	Iterate(context.Context, Filter, func(Mapping) error) error
+}
+
+// Listener is implemented by allocators signalling changed allocations,
+// including those made by other processes
+type Listener interface {
+	// Listen sends on the channel after allocations have changed, without
+	// blocking, until the context is cancelled
+	Listen(context.Context, chan<- struct{})
+}
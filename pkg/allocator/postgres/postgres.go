@@ -32,6 +32,10 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -41,6 +45,9 @@ import (
 	"go-dovecot-director/pkg/pool"
 )
 
+// notifyChannel is the channel of allocation change notifications
+const notifyChannel = "mailbox_username_backend"
+
 type postgresAllocator struct {
 	pg *pgxpool.Pool
 	be pool.Pool
@@ -54,7 +61,13 @@ func New(pg *pgxpool.Pool, be pool.Pool) allocator.Allocator {
 }
 
 // Allocate implements allocator.Allocator.
-func (p *postgresAllocator) Allocate(ctx context.Context, username string) (backend string, err error) {
+func (p *postgresAllocator) Allocate(ctx context.Context, username string) (string, error) {
+	backend, err := p.allocate(ctx, username)
+
+	return backend, classify(err)
+}
+
+func (p *postgresAllocator) allocate(ctx context.Context, username string) (backend string, err error) {
 	// One query without transaction, optimistic path
 	if err = p.pg.QueryRow(ctx, "SELECT backend FROM mailbox_username_backend WHERE username = $1", username).Scan(&backend); err == nil {
 		if available, _ := p.be.IsBackendAlive(ctx, backend); available {
@@ -67,6 +80,79 @@ func (p *postgresAllocator) Allocate(ctx context.Context, username string) (back
 	return p.allocateTx(ctx, username)
 }
 
+// Lookup implements allocator.Store.
+func (p *postgresAllocator) Lookup(ctx context.Context, username string) (backend string, err error) {
+	if err = p.pg.QueryRow(ctx, "SELECT backend FROM mailbox_username_backend WHERE username = $1", username).Scan(&backend); errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+	}
+
+	return backend, classify(err)
+}
+
+// Iterate implements allocator.Store.
+func (p *postgresAllocator) Iterate(ctx context.Context, filter allocator.Filter, fn func(allocator.Mapping) error) error {
+	rows, err := p.pg.Query(ctx,
+		"SELECT username, backend FROM mailbox_username_backend "+
+			"WHERE ($1 = '' OR backend = $1) AND ($2 = '' OR right(username, length($2) + 1) = '@' || $2) "+
+			"ORDER BY username",
+		filter.Backend, filter.Domain,
+	)
+	if err != nil {
+		return err
+	}
+
+	var mapping allocator.Mapping
+	_, err = pgx.ForEachRow(rows, []any{&mapping.Username, &mapping.Backend}, func() error {
+		return fn(mapping)
+	})
+
+	return err
+}
+
+// Listen implements allocator.Listener.
+func (p *postgresAllocator) Listen(ctx context.Context, ch chan<- struct{}) {
+	for {
+		err := p.listen(ctx, ch)
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		log.Print(err)
+
+		time.Sleep(time.Second)
+	}
+}
+
+// listen forwards notifications on a dedicated connection, until it fails
+func (p *postgresAllocator) listen(ctx context.Context, ch chan<- struct{}) error {
+	conn, err := p.pg.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the listening connection is not returned to the pool
+	c := conn.Hijack()
+	defer c.Close(context.Background())
+
+	if _, err = c.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		if _, err = c.WaitForNotification(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // allocates in a transaction
 func (p *postgresAllocator) allocateTx(ctx context.Context, username string) (backend string, err error) {
 	var tx pgx.Tx
@@ -98,22 +184,51 @@ func (p *postgresAllocator) allocateTx(ctx context.Context, username string) (ba
 		_, err = tx.Exec(ctx, "UPDATE mailbox_username_backend SET backend = $1, last_ts = NOW() WHERE username = $2", backend, username)
 	} else {
 		_, err = tx.Exec(ctx, "INSERT INTO mailbox_username_backend(backend, username, last_ts) VALUES ($1, $2, NOW())", backend, username)
-
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == "23503" {
-				err = nil
-
-				return
-			}
-		}
 	}
 
 	if err != nil {
 		return
 	}
 
+	// delivered to listeners on commit
+	if _, err = tx.Exec(ctx, "SELECT pg_notify($1, $2)", notifyChannel, username); err != nil {
+		return
+	}
+
 	err = tx.Commit(ctx)
 
 	return
 }
+
+// classify maps errors to the allocator errors
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, pool.ErrNoBackends) {
+		return allocator.ErrNoBackends
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		// connection failures and timeouts
+		return fmt.Errorf("%w: %w", allocator.ErrTemporary, err)
+	}
+
+	switch {
+	case pgErr.Code == "23503":
+		// the mailbox of the user does not exist
+		return allocator.ErrUserUnknown
+	case pgErr.Code == "55P03",
+		strings.HasPrefix(pgErr.Code, "08"),
+		strings.HasPrefix(pgErr.Code, "40"),
+		strings.HasPrefix(pgErr.Code, "53"),
+		strings.HasPrefix(pgErr.Code, "57"):
+		// connection exceptions, rollbacks, insufficient resources and
+		// operator intervention
+		return fmt.Errorf("%w: %w", allocator.ErrTemporary, err)
+	}
+
+	return fmt.Errorf("%w: %w", allocator.ErrInternal, err)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/pool"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "nil"},
+		{name: "no backends", err: fmt.Errorf("pool: %w", pool.ErrNoBackends), want: allocator.ErrNoBackends},
+		{name: "foreign key violation", err: &pgconn.PgError{Code: "23503"}, want: allocator.ErrUserUnknown},
+		{name: "connection failure", err: &pgconn.PgError{Code: "08006"}, want: allocator.ErrTemporary},
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, want: allocator.ErrTemporary},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, want: allocator.ErrTemporary},
+		{name: "lock not available", err: &pgconn.PgError{Code: "55P03"}, want: allocator.ErrTemporary},
+		{name: "too many connections", err: &pgconn.PgError{Code: "53300"}, want: allocator.ErrTemporary},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: "57P01"}, want: allocator.ErrTemporary},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}, want: allocator.ErrInternal},
+		{name: "undefined table", err: &pgconn.PgError{Code: "42P01"}, want: allocator.ErrInternal},
+		{name: "wrapped", err: fmt.Errorf("query: %w", &pgconn.PgError{Code: "23503"}), want: allocator.ErrUserUnknown},
+		{name: "timeout", err: context.DeadlineExceeded, want: allocator.ErrTemporary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("err = %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+
+			// the cause is kept for logging
+			var pgErr *pgconn.PgError
+			if errors.As(tt.err, &pgErr) && tt.want != allocator.ErrUserUnknown && !errors.As(err, &pgErr) {
+				t.Errorf("err = %v lost its cause", err)
+			}
+		})
+	}
+}
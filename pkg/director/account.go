@@ -0,0 +1,111 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/overrides"
+	"go-dovecot-director/pkg/password"
+)
+
+var (
+	errPasswordMismatch = errors.New("password mismatch")
+	errUserDisabled     = errors.New("user disabled")
+)
+
+// authenticate routes a request, verifying its password if enabled
+func (d *Director) authenticate(ctx context.Context, authRequest *dovecot.Request) (*dovecot.ResponseAttributes, error) {
+	return d.proxyLookup(ctx, overrides.DatabasePassdb, authRequest, d.verifyPasswords)
+}
+
+// authenticateHTTP is authenticate for HTTP passdb requests. The master
+// user of a request skips password verification, so it is only trusted
+// from clients authenticated by the token.
+func (d *Director) authenticateHTTP(ctx context.Context, authRequest *dovecot.Request) (*dovecot.ResponseAttributes, error) {
+	if d.verifyPasswords && d.token == "" && authRequest.MasterUser != "" {
+		return nil, &dovecot.RequestError{Field: "master_user", Reason: "not trusted without a token"}
+	}
+
+	return d.authenticate(ctx, authRequest)
+}
+
+// checkAccount checks the target mailbox for being active if enabled, and
+// verifies the password of the user against its hash if asked for. Master
+// user logins are authenticated by Dovecot's master passdb, so the master
+// user must come from a trusted caller. The target mailbox is returned if it
+// was read.
+func (d *Director) checkAccount(ctx context.Context, authRequest *dovecot.Request, target string, verifyPassword bool) (*mailbox.Mailbox, error) {
+	if !d.checkStatus && !verifyPassword {
+		return nil, nil
+	}
+
+	m, err := d.mailboxes.Get(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.checkStatus {
+		if !m.DomainActive {
+			return nil, fmt.Errorf("%w: domain %s is disabled", errUserDisabled, m.Domain)
+		}
+
+		if !m.Active {
+			return nil, errUserDisabled
+		}
+	}
+
+	if !verifyPassword || authRequest.MasterUser != "" {
+		return m, nil
+	}
+
+	// the master passdb is queried for the master user
+	pm := m
+	if target != authRequest.User {
+		if pm, err = d.mailboxes.Get(ctx, authRequest.User); err != nil {
+			return nil, err
+		}
+	}
+
+	ok, err := password.Verify(authRequest.Password, pm.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errPasswordMismatch
+	}
+
+	return m, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/password"
+)
+
+func TestAuthenticate(t *testing.T) {
+	mailboxes := staticMailboxes{
+		"a@example.com":      {Username: "a@example.com", Password: "{PLAIN}secret", Active: true, DomainActive: true},
+		"b@example.com":      {Username: "b@example.com", Password: "{PLAIN}secret", DomainActive: true},
+		"c@example.org":      {Username: "c@example.org", Password: "{PLAIN}secret", Active: true},
+		"d@example.com":      {Username: "d@example.com", Password: "{ARGON2I}x", Active: true, DomainActive: true},
+		"master@example.com": {Username: "master@example.com", Password: "{PLAIN}master", Active: true, DomainActive: true},
+	}
+	users := staticAllocator{
+		"a@example.com": "10.0.0.1",
+		"b@example.com": "10.0.0.1",
+		"c@example.org": "10.0.0.1",
+		"d@example.com": "10.0.0.1",
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		http     bool
+		request  dovecot.Request
+		err      error
+		errField string
+	}{
+		{name: "password", request: dovecot.Request{User: "a@example.com", Password: "secret"}},
+		{name: "password mismatch", request: dovecot.Request{User: "a@example.com", Password: "wrong"}, err: errPasswordMismatch},
+		{name: "disabled", request: dovecot.Request{User: "b@example.com", Password: "secret"}, err: errUserDisabled},
+		{name: "domain disabled", request: dovecot.Request{User: "c@example.org", Password: "secret"}, err: errUserDisabled},
+		{name: "unknown", request: dovecot.Request{User: "e@example.com", Password: "secret"}, err: mailbox.ErrNotFound},
+		{name: "unknown scheme", request: dovecot.Request{User: "d@example.com", Password: "secret"}, err: password.ErrUnknownScheme},
+		{name: "master user", request: dovecot.Request{User: "a@example.com", MasterUser: "master@example.com"}},
+		{name: "http master user with token", token: "token", http: true, request: dovecot.Request{User: "a@example.com", MasterUser: "master@example.com"}},
+		{name: "http master user without token", http: true, request: dovecot.Request{User: "a@example.com", MasterUser: "master@example.com"}, errField: "master_user"},
+		{name: "http password without token", http: true, request: dovecot.Request{User: "a@example.com", Password: "secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(users, WithMailboxes(mailboxes), WithPasswordVerification(true), WithStatusCheck(true), WithToken(tt.token))
+
+			authenticate := d.authenticate
+			if tt.http {
+				authenticate = d.authenticateHTTP
+			}
+
+			request := tt.request
+			request.SetUser(request.User)
+
+			attrs, err := authenticate(context.Background(), &request)
+
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+			case tt.errField != "":
+				var requestError *dovecot.RequestError
+				if !errors.As(err, &requestError) || requestError.Field != tt.errField {
+					t.Errorf("err = %v, want a RequestError of %s", err, tt.errField)
+				}
+			case err != nil:
+				t.Errorf("err = %v", err)
+			case attrs.Host != "10.0.0.1":
+				t.Errorf("got host %q", attrs.Host)
+			}
+		})
+	}
+}
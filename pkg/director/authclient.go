@@ -0,0 +1,304 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// Dovecot auth-client protocol, as in src/lib-auth/auth-client-interface.h
+const (
+	authClientMajorVersion = "1"
+	authClientMinorVersion = "2"
+)
+
+var authClientConnectionId atomic.Uint64
+
+// ServeAuthClient serves Dovecot's native auth-client protocol on l
+func (d *Director) ServeAuthClient(ctx context.Context, l net.Listener) error {
+	return serveConns(ctx, l, d.handleAuthClient)
+}
+
+// authClientRequest holds the state of a multi-step authentication
+type authClientRequest struct {
+	request *dovecot.Request
+	step    int
+}
+
+type authClientConn struct {
+	*lineConn
+
+	director *Director
+
+	lock    sync.Mutex
+	pending map[string]*authClientRequest
+
+	// authentications in progress, their replies are awaited before the
+	// connection is closed
+	wg sync.WaitGroup
+}
+
+func (d *Director) handleAuthClient(ctx context.Context, conn net.Conn) {
+	c := &authClientConn{
+		lineConn: newLineConn(conn),
+		director: d,
+		pending:  make(map[string]*authClientRequest),
+	}
+
+	defer c.wg.Wait()
+
+	if err := c.handshake(); err != nil {
+		log.Print(err)
+
+		return
+	}
+
+	for {
+		args, err := c.readLine()
+		if err != nil {
+			return
+		}
+
+		switch args[0] {
+		case "VERSION":
+			if len(args) < 2 || args[1] != authClientMajorVersion {
+				log.Printf("Unsupported auth-client protocol version: %q", args)
+
+				return
+			}
+		case "CPID":
+		case "AUTH":
+			err = c.auth(ctx, args[1:])
+		case "CONT":
+			err = c.cont(ctx, args[1:])
+		default:
+			log.Printf("Unknown auth-client command: %q", args[0])
+
+			return
+		}
+
+		if err != nil {
+			log.Print(err)
+
+			return
+		}
+	}
+}
+
+func (c *authClientConn) handshake() error {
+	cookie := make([]byte, 16)
+	rand.Read(cookie)
+
+	for _, line := range [][]string{
+		{"VERSION", authClientMajorVersion, authClientMinorVersion},
+		{"MECH", "PLAIN", "plaintext"},
+		{"MECH", "LOGIN", "plaintext"},
+		{"SPID", strconv.Itoa(os.Getpid())},
+		{"CUID", strconv.FormatUint(authClientConnectionId.Add(1), 10)},
+		{"COOKIE", hex.EncodeToString(cookie)},
+		{"DONE"},
+	} {
+		if err := c.writeLine(line...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// auth handles AUTH <id> <mech> [<params>...]
+func (c *authClientConn) auth(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return c.writeLine("FAIL", "", "reason=Invalid AUTH request")
+	}
+
+	id, mech := args[0], strings.ToUpper(args[1])
+
+	request := &dovecot.Request{Mech: mech}
+	var resp *string
+
+	for _, param := range args[2:] {
+		key, value := splitParam(param)
+		if key == "resp" {
+			resp = &value
+		} else if err := request.Set(key, value); err != nil {
+			return c.writeLine("FAIL", id, "reason="+err.Error())
+		}
+	}
+
+	state := &authClientRequest{request: request}
+
+	switch mech {
+	case "PLAIN":
+		if resp == nil {
+			c.setPending(id, state)
+
+			return c.writeLine("CONT", id, "")
+		}
+	case "LOGIN":
+		// an initial response is the user name, as in Dovecot's mech-login
+		if resp == nil || *resp == "" {
+			c.setPending(id, state)
+
+			return c.writeLine("CONT", id, base64.StdEncoding.EncodeToString([]byte("Username:")))
+		}
+	default:
+		return c.writeLine("FAIL", id, "reason=Unsupported authentication mechanism")
+	}
+
+	return c.step(ctx, id, state, *resp)
+}
+
+// cont handles CONT <id> <data>
+func (c *authClientConn) cont(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return c.writeLine("FAIL", "", "reason=Invalid CONT request")
+	}
+
+	c.lock.Lock()
+	state, ok := c.pending[args[0]]
+	delete(c.pending, args[0])
+	c.lock.Unlock()
+
+	if !ok {
+		return c.writeLine("FAIL", args[0], "reason=Unknown request")
+	}
+
+	return c.step(ctx, args[0], state, args[1])
+}
+
+func (c *authClientConn) setPending(id string, state *authClientRequest) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.pending[id] = state
+}
+
+// step processes the next client response of a request
+func (c *authClientConn) step(ctx context.Context, id string, state *authClientRequest, resp string) error {
+	data, err := base64.StdEncoding.DecodeString(resp)
+	if err != nil {
+		return c.writeLine("FAIL", id, "reason=Invalid base64 data")
+	}
+
+	request := state.request
+
+	switch request.Mech {
+	case "PLAIN":
+		parts := bytes.Split(data, []byte{0})
+		if len(parts) != 3 || len(parts[1]) == 0 {
+			return c.writeLine("FAIL", id, "reason=Invalid PLAIN data")
+		}
+
+		request.SetUser(string(parts[1]))
+		if len(parts[0]) > 0 && !bytes.Equal(parts[0], parts[1]) {
+			request.SetUser(string(parts[0]))
+			request.MasterUser = string(parts[1])
+
+			// there is no master passdb authenticating the master user
+			if c.director.verifyPasswords {
+				return c.writeLine("FAIL", id, "reason=Master user logins are not supported")
+			}
+		}
+		request.Password = string(parts[2])
+	case "LOGIN":
+		state.step++
+
+		if state.step == 1 {
+			request.SetUser(string(data))
+			c.setPending(id, state)
+
+			return c.writeLine("CONT", id, base64.StdEncoding.EncodeToString([]byte("Password:")))
+		}
+
+		request.Password = string(data)
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		c.authenticate(ctx, id, request)
+	}()
+
+	return nil
+}
+
+func (c *authClientConn) authenticate(ctx context.Context, id string, request *dovecot.Request) {
+	// authentication is left to the following passdbs, which auth clients
+	// do not have
+	if c.director.chain.Next {
+		if err := c.writeLine("FAIL", id, "user="+request.User, "reason=Authentication is left to the following passdbs"); err != nil {
+			log.Print(err)
+		}
+
+		return
+	}
+
+	attrs, err := c.director.authenticate(ctx, request)
+
+	var fields []string
+	if err == nil {
+		fields, err = attrs.Fields()
+	}
+
+	// the login process needs the password to log in to the backend
+	if err == nil && (attrs.Proxy || attrs.ProxyMaybe) && !slices.ContainsFunc(fields, func(field string) bool {
+		return strings.HasPrefix(field, "pass=")
+	}) {
+		fields = append(fields, "pass="+request.Password)
+	}
+
+	if loginFailed(err) {
+		err = c.writeLine("FAIL", id, "user="+request.User)
+	} else if err != nil {
+		err = c.writeLine("FAIL", id, "user="+request.User, "temp")
+	} else {
+		err = c.writeLine(append([]string{"OK", id, "user=" + request.User}, fields...)...)
+	}
+
+	if err != nil {
+		log.Print(err)
+	}
+}
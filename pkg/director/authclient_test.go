@@ -0,0 +1,105 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestAuthClient(t *testing.T) {
+	d := New(staticAllocator{"user@example.com": "10.0.0.1"})
+
+	plain := func(user, password string) string {
+		return base64.StdEncoding.EncodeToString([]byte("\x00" + user + "\x00" + password))
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		reply string
+	}{
+		{
+			name:  "plain",
+			lines: []string{"AUTH\t1\tPLAIN\tservice=imap\tresp=" + plain("user@example.com", "secret")},
+			reply: "OK\t1\tuser=user@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y\tpass=secret",
+		},
+		{
+			name:  "plain continued",
+			lines: []string{"AUTH\t2\tPLAIN\tservice=imap", "CONT\t2\t" + plain("user@example.com", "secret")},
+			reply: "OK\t2\tuser=user@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y\tpass=secret",
+		},
+		{
+			name: "login",
+			lines: []string{
+				"AUTH\t3\tLOGIN\tservice=imap",
+				"CONT\t3\t" + base64.StdEncoding.EncodeToString([]byte("user@example.com")),
+				"CONT\t3\t" + base64.StdEncoding.EncodeToString([]byte("secret")),
+			},
+			reply: "OK\t3\tuser=user@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y\tpass=secret",
+		},
+		{
+			name: "login initial response",
+			lines: []string{
+				"AUTH\t6\tLOGIN\tservice=submission\tresp=" + base64.StdEncoding.EncodeToString([]byte("user@example.com")),
+				"CONT\t6\t" + base64.StdEncoding.EncodeToString([]byte("se cret")),
+			},
+			reply: "OK\t6\tuser=user@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y\tpass=se cret",
+		},
+		{
+			name:  "unknown user",
+			lines: []string{"AUTH\t4\tPLAIN\tservice=imap\tresp=" + plain("nobody@example.com", "secret")},
+			reply: "FAIL\t4\tuser=nobody@example.com",
+		},
+		{
+			name:  "unsupported mechanism",
+			lines: []string{"AUTH\t5\tCRAM-MD5\tservice=imap"},
+			reply: "FAIL\t5\treason=Unsupported authentication mechanism",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, d.handleAuthClient, "DONE")
+
+			var reply string
+			for _, line := range tt.lines {
+				if reply = exchange(t, c, line); !strings.HasPrefix(reply, "CONT") {
+					break
+				}
+			}
+
+			if reply != tt.reply {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/overrides"
+)
+
+// Dovecot auth-master protocol, as in src/lib-auth/auth-master.h
+const (
+	authMasterMajorVersion = "1"
+	authMasterMinorVersion = "0"
+)
+
+// ServeAuthMaster serves Dovecot's auth-master (userdb) protocol on l
+func (d *Director) ServeAuthMaster(ctx context.Context, l net.Listener) error {
+	return serveConns(ctx, l, d.handleAuthMaster)
+}
+
+func (d *Director) handleAuthMaster(ctx context.Context, conn net.Conn) {
+	c := newLineConn(conn)
+
+	if err := c.writeLine("VERSION", authMasterMajorVersion, authMasterMinorVersion); err != nil {
+		log.Print(err)
+
+		return
+	}
+	if err := c.writeLine("SPID", strconv.Itoa(os.Getpid())); err != nil {
+		log.Print(err)
+
+		return
+	}
+
+	for {
+		args, err := c.readLine()
+		if err != nil {
+			return
+		}
+
+		if args[0] == "VERSION" {
+			if len(args) < 2 || args[1] != authMasterMajorVersion {
+				log.Printf("Unsupported auth-master protocol version: %q", args)
+
+				return
+			}
+
+			continue
+		}
+
+		if len(args) < 2 {
+			log.Printf("Invalid auth-master request: %q", args)
+
+			return
+		}
+
+		switch args[0] {
+		case "USER", "PASS":
+			err = d.authMasterLookup(ctx, c, args[0], args[1], args[2:])
+		case "LIST":
+			err = d.authMasterList(ctx, c, args[1], args[2:])
+		default:
+			err = c.writeLine("FAIL", args[1], "reason=Unsupported command")
+		}
+
+		if err != nil {
+			log.Print(err)
+
+			return
+		}
+	}
+}
+
+// authMasterLookup handles USER|PASS <id> <user> [<params>...]
+func (d *Director) authMasterLookup(ctx context.Context, c *lineConn, cmd, id string, args []string) error {
+	if len(args) < 1 {
+		return c.writeLine("FAIL", id, "reason=Missing user")
+	}
+
+	request := &dovecot.Request{}
+	request.SetUser(args[0])
+	for _, param := range args[1:] {
+		if err := request.Set(splitParam(param)); err != nil {
+			return c.writeLine("FAIL", id, "reason="+err.Error())
+		}
+	}
+
+	var attrs *dovecot.ResponseAttributes
+	var err error
+	if cmd == "PASS" {
+		attrs, err = d.lookup(ctx, overrides.DatabasePassdb, request)
+
+		// the following passdbs authenticate the user
+		if err == nil && d.chain.Next {
+			attrs.Nopassword = false
+		}
+	} else {
+		attrs, err = d.userLookup(ctx, request)
+	}
+	if userUnknown(err) {
+		return c.writeLine("NOTFOUND", id)
+	}
+
+	var fields []string
+	if err == nil {
+		fields, err = attrs.Fields()
+	}
+
+	if err != nil {
+		return c.writeLine("FAIL", id, "reason="+err.Error())
+	}
+
+	user := request.User
+	if cmd == "PASS" {
+		user = "user=" + user
+	}
+
+	return c.writeLine(append([]string{cmd, id, user}, fields...)...)
+}
+
+// authMasterList handles LIST <id> [user=<mask>] [<params>...]
+func (d *Director) authMasterList(ctx context.Context, c *lineConn, id string, args []string) error {
+	var mask string
+	for _, param := range args {
+		if value, found := strings.CutPrefix(param, "user="); found {
+			mask = value
+		}
+	}
+
+	store, ok := d.allocator.(allocator.Store)
+	if !ok {
+		log.Print(errStoreNotSupported)
+
+		return c.writeLine("DONE", id, "fail")
+	}
+
+	err := store.Iterate(ctx, allocator.Filter{}, func(mapping allocator.Mapping) error {
+		if mask != "" && !wildcardMatch(mapping.Username, mask) {
+			return nil
+		}
+
+		return c.writeLine("LIST", id, mapping.Username)
+	})
+	if err != nil {
+		log.Print(err)
+
+		return c.writeLine("DONE", id, "fail")
+	}
+
+	return c.writeLine("DONE", id)
+}
+
+// wildcardMatch matches s against a Dovecot style mask with * and ? wildcards
+func wildcardMatch(s, mask string) bool {
+	for len(mask) > 0 {
+		switch mask[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(s[i:], mask[1:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != mask[0] {
+				return false
+			}
+		}
+
+		s, mask = s[1:], mask[1:]
+	}
+
+	return len(s) == 0
+}
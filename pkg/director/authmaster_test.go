@@ -0,0 +1,183 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"strings"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestAuthMaster(t *testing.T) {
+	d := New(staticAllocator{
+		"user@example.com":  "10.0.0.1",
+		"other@example.org": "10.0.0.2",
+	})
+
+	tests := []struct {
+		name  string
+		lines []string
+		reply []string
+	}{
+		{
+			name:  "user",
+			lines: []string{"USER\t1\tuser@example.com\tservice=lmtp"},
+			reply: []string{"USER\t1\tuser@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y"},
+		},
+		{
+			name:  "pass",
+			lines: []string{"PASS\t2\tuser@example.com\tservice=imap"},
+			reply: []string{"PASS\t2\tuser=user@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y"},
+		},
+		{
+			name:  "unknown user",
+			lines: []string{"USER\t3\tnobody@example.com\tservice=lmtp"},
+			reply: []string{"NOTFOUND\t3"},
+		},
+		{
+			name:  "invalid parameter",
+			lines: []string{"USER\t4\tuser@example.com\tlport=x"},
+			reply: []string{"FAIL\t4\treason=invalid lport: invalid port: \"x\""},
+		},
+		{
+			name:  "list",
+			lines: []string{"LIST\t5\tuser=*@example.*"},
+			reply: []string{"LIST\t5\tother@example.org", "LIST\t5\tuser@example.com", "DONE\t5"},
+		},
+		{
+			name:  "list mask",
+			lines: []string{"LIST\t6\tuser=user@*"},
+			reply: []string{"LIST\t6\tuser@example.com", "DONE\t6"},
+		},
+		{
+			name:  "unsupported command",
+			lines: []string{"CPID\t7"},
+			reply: []string{"FAIL\t7\treason=Unsupported command"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, d.handleAuthMaster, "SPID")
+
+			for _, line := range tt.lines {
+				reply := exchange(t, c, line)
+				for i, want := range tt.reply {
+					if i > 0 {
+						args, err := c.readLine()
+						if err != nil {
+							t.Fatal(err)
+						}
+						reply = strings.Join(args, "\t")
+					}
+
+					if reply != want {
+						t.Errorf("reply %d = %q, want %q", i, reply, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAuthMasterUserdb(t *testing.T) {
+	mailboxes := staticMailboxes{
+		"user@example.com": {Username: "user@example.com", Maildir: "example.com/user/", Quota: 1024},
+	}
+	templates := UserdbTemplates{UID: "vmail", GID: "vmail", Home: "/var/mail/%{maildir}", Mail: "maildir:~/Maildir:LAYOUT=fs"}
+
+	tests := []struct {
+		name    string
+		version dovecot.Version
+		line    string
+		reply   string
+	}{
+		{
+			name:    "user",
+			version: dovecot.Version23,
+			line:    "USER\t1\tuser@example.com\tservice=lmtp",
+			reply:   "USER\t1\tuser@example.com\tgid=vmail\thome=/var/mail/example.com/user/\tmail=maildir:~/Maildir:LAYOUT=fs\tquota_rule=*:storage=1024B\tuid=vmail",
+		},
+		{
+			name:    "user 2.4",
+			version: dovecot.Version24,
+			line:    "USER\t2\tuser@example.com\tservice=lmtp",
+			reply: "USER\t2\tuser@example.com\tgid=vmail\thome=/var/mail/example.com/user/\tmail_driver=maildir\tmail_path=~/Maildir" +
+				"\tmailbox_list_layout=fs\tquota_storage_size=1024\tuid=vmail",
+		},
+		{
+			name:    "pass",
+			version: dovecot.Version23,
+			line:    "PASS\t3\tuser@example.com\tservice=imap",
+			reply:   "PASS\t3\tuser=user@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y",
+		},
+		{
+			name:    "unknown mailbox",
+			version: dovecot.Version23,
+			line:    "USER\t4\tnobody@example.com\tservice=lmtp",
+			reply:   "NOTFOUND\t4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(staticAllocator{"user@example.com": "10.0.0.1", "nobody@example.com": "10.0.0.1"},
+				WithMailboxes(mailboxes), WithUserdb(templates, nil), WithDovecotVersion(tt.version))
+
+			c := dial(t, d.handleAuthMaster, "SPID")
+			if reply := exchange(t, c, tt.line); reply != tt.reply {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+		})
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		s, mask string
+		match   bool
+	}{
+		{"user@example.com", "user@example.com", true},
+		{"user@example.com", "*", true},
+		{"user@example.com", "*@example.com", true},
+		{"user@example.com", "user@*.org", false},
+		{"user@example.com", "us?r@*", true},
+		{"user@example.com", "u?@*", false},
+		{"", "*", true},
+		{"", "?", false},
+	}
+
+	for _, tt := range tests {
+		if match := wildcardMatch(tt.s, tt.mask); match != tt.match {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.s, tt.mask, match, tt.match)
+		}
+	}
+}
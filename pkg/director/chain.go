@@ -0,0 +1,71 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var errNotOwned = errors.New("domain not handled by the director")
+
+// ChainConfig makes the director part of a passdb chain, leaving users to
+// the following passdbs with PASSDB_RESULT_NEXT
+type ChainConfig struct {
+	// Next answers successful passdb lookups with PASSDB_RESULT_NEXT and the
+	// proxy fields, so the following passdbs authenticate the user
+	Next bool
+
+	// Domains handled by the director, users of other domains are passed to
+	// the following passdbs. Empty handles all domains.
+	Domains []string
+
+	// NextUnknown passes unknown users to the following passdbs instead of
+	// answering PASSDB_RESULT_USER_UNKNOWN
+	NextUnknown bool
+}
+
+// Owns tells whether the director handles users of domain
+func (c *ChainConfig) Owns(domain string) bool {
+	if len(c.Domains) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(c.Domains, func(d string) bool {
+		return strings.EqualFold(d, domain)
+	})
+}
+
+// next tells whether a failed passdb lookup is passed to the following
+// passdbs
+func (c *ChainConfig) next(err error) bool {
+	return errors.Is(err, errNotOwned) || (c.NextUnknown && userUnknown(err) && !errors.Is(err, errUserDisabled))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestChainOwns(t *testing.T) {
+	tests := []struct {
+		domains []string
+		domain  string
+		owns    bool
+	}{
+		{domain: "example.com", owns: true},
+		{domain: "", owns: true},
+		{domains: []string{"example.com"}, domain: "example.com", owns: true},
+		{domains: []string{"example.com"}, domain: "EXAMPLE.com", owns: true},
+		{domains: []string{"example.com"}, domain: "example.org"},
+		{domains: []string{"example.com"}, domain: ""},
+	}
+
+	for _, tt := range tests {
+		c := ChainConfig{Domains: tt.domains}
+		if owns := c.Owns(tt.domain); owns != tt.owns {
+			t.Errorf("%v owns %q = %v, want %v", tt.domains, tt.domain, owns, tt.owns)
+		}
+	}
+}
+
+func TestChainNext(t *testing.T) {
+	// backends are allocated for the local part, so ownership must be
+	// decided on the domain of the request
+	routingKey, err := dovecot.ParseTemplate("%{username}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(staticAllocator{"user": "10.0.0.1"},
+		WithRoutingKey(routingKey),
+		WithChaining(ChainConfig{Next: true, Domains: []string{"example.com"}}),
+	)
+
+	t.Run("http", func(t *testing.T) {
+		tests := []struct {
+			user string
+			host string
+		}{
+			{user: "user@example.com", host: "10.0.0.1"},
+			{user: "user@example.org"},
+		}
+
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodPost, authPassdbLookupUri, strings.NewReader(`{"user": "`+tt.user+`", "service": "imap"}`))
+			w := httptest.NewRecorder()
+
+			d.authPassdbLookup(context.Background(), w, r)
+
+			var response struct {
+				Code       dovecot.PassdbResult `json:"code"`
+				Attributes map[string]any       `json:"attributes"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			if response.Code != dovecot.PASSDB_RESULT_NEXT {
+				t.Errorf("%s: code = %d", tt.user, response.Code)
+			}
+			if host, _ := response.Attributes["host"].(string); host != tt.host {
+				t.Errorf("%s: host = %q, want %q", tt.user, host, tt.host)
+			}
+			if _, ok := response.Attributes["nopassword"]; ok {
+				t.Errorf("%s: nopassword returned", tt.user)
+			}
+		}
+	})
+
+	t.Run("auth-master", func(t *testing.T) {
+		tests := []struct {
+			line  string
+			reply string
+		}{
+			{line: "PASS\t1\tuser@example.com\tservice=imap", reply: "PASS\t1\tuser=user@example.com\thost=10.0.0.1\tproxy=y"},
+			{line: "PASS\t2\tuser@example.org\tservice=imap", reply: "NOTFOUND\t2"},
+			{line: "USER\t3\tuser@example.com\tservice=lmtp", reply: "USER\t3\tuser@example.com\thost=10.0.0.1\tnopassword=y\tproxy=y"},
+		}
+
+		c := dial(t, d.handleAuthMaster, "SPID")
+		for _, tt := range tests {
+			if reply := exchange(t, c, tt.line); reply != tt.reply {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+		}
+	})
+
+	t.Run("auth-client", func(t *testing.T) {
+		resp := base64.StdEncoding.EncodeToString([]byte("\x00user@example.com\x00secret"))
+
+		c := dial(t, d.handleAuthClient, "DONE")
+		reply := exchange(t, c, "AUTH\t1\tPLAIN\tservice=imap\tresp="+resp)
+
+		if want := "FAIL\t1\tuser=user@example.com\treason=Authentication is left to the following passdbs"; reply != want {
+			t.Errorf("reply = %q, want %q", reply, want)
+		}
+	})
+}
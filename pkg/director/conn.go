@@ -0,0 +1,152 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+const maxLineLength = 1 << 16
+
+// serveConns accepts connections until ctx is cancelled, and runs handle for
+// each of them in its own goroutine
+func serveConns(ctx context.Context, l net.Listener, handle func(context.Context, net.Conn)) error {
+	go func() {
+		<-ctx.Done()
+
+		l.Close()
+	}()
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			connCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			// on shutdown only reading is stopped, so pending replies are
+			// still sent
+			go func() {
+				<-connCtx.Done()
+
+				if cr, ok := conn.(interface{ CloseRead() error }); ok {
+					cr.CloseRead()
+				} else {
+					conn.Close()
+				}
+			}()
+
+			handle(connCtx, conn)
+		}()
+	}
+}
+
+// lineConn is a connection speaking a tab separated line based protocol
+type lineConn struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+
+	lock sync.Mutex
+}
+
+func newLineConn(conn net.Conn) *lineConn {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+
+	return &lineConn{
+		conn:    conn,
+		scanner: scanner,
+	}
+}
+
+// readLine reads a line, and returns its unescaped arguments
+func (c *lineConn) readLine() ([]string, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, net.ErrClosed
+	}
+
+	args := strings.Split(strings.TrimSuffix(c.scanner.Text(), "\r"), "\t")
+	for i := range args {
+		args[i] = dovecot.TabUnescape(args[i])
+	}
+
+	return args, nil
+}
+
+// writeLine escapes and sends args as one line, it is safe for concurrent use
+func (c *lineConn) writeLine(args ...string) error {
+	escaped := make([]string, len(args))
+	for i := range args {
+		escaped[i] = dovecot.TabEscape(args[i])
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, err := c.conn.Write([]byte(strings.Join(escaped, "\t") + "\n"))
+
+	return err
+}
+
+// splitParam splits a key=value protocol parameter, a bare key is treated as
+// having its own name as value
+func splitParam(param string) (string, string) {
+	key, value, found := strings.Cut(param, "=")
+	if !found {
+		value = key
+	}
+
+	return key, value
+}
@@ -0,0 +1,211 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"go-dovecot-director/pkg/allocator"
+)
+
+// Dovecot dict protocol, as in src/lib-dict/dict-client.h
+const (
+	dictMajorVersion = "3"
+
+	dictIterateFlagExactKey = 0x10
+	dictIterateFlagNoValue  = 0x08
+
+	dictKeyPrefix = "shared/director/"
+)
+
+var (
+	errStoreNotSupported = errors.New("allocator does not support enumerating mappings")
+	errMaxRows           = errors.New("max rows reached")
+)
+
+// ServeDict serves Dovecot's dict protocol on l, exposing user mappings as
+// shared/director/<user> keys
+func (d *Director) ServeDict(ctx context.Context, l net.Listener) error {
+	return serveConns(ctx, l, d.handleDict)
+}
+
+// dictConn is a dict protocol connection, the commands are a single
+// character directly followed by their tab separated arguments
+type dictConn struct {
+	*lineConn
+
+	store allocator.Store
+
+	// transactions with pending changes
+	transactions map[string]bool
+}
+
+func (d *Director) handleDict(ctx context.Context, conn net.Conn) {
+	store, ok := d.allocator.(allocator.Store)
+	if !ok {
+		log.Print(errStoreNotSupported)
+
+		return
+	}
+
+	c := &dictConn{
+		lineConn:     newLineConn(conn),
+		store:        store,
+		transactions: make(map[string]bool),
+	}
+
+	for {
+		args, err := c.readLine()
+		if err != nil || len(args[0]) == 0 {
+			return
+		}
+
+		cmd := args[0][0]
+		args[0] = args[0][1:]
+
+		switch cmd {
+		case 'H':
+			if args[0] != dictMajorVersion {
+				log.Printf("Unsupported dict protocol version: %q", args)
+
+				return
+			}
+		case 'L':
+			err = c.lookup(ctx, args[0])
+		case 'I':
+			err = c.iterate(ctx, args)
+		case 'B':
+			c.transactions[args[0]] = false
+		case 'S', 'U', 'A':
+			c.transactions[args[0]] = true
+		case 'T':
+		case 'R':
+			delete(c.transactions, args[0])
+		case 'C', 'D':
+			err = c.commit(args[0])
+		default:
+			log.Printf("Unknown dict command: %q", cmd)
+
+			return
+		}
+
+		if err != nil {
+			log.Print(err)
+
+			return
+		}
+	}
+}
+
+// lookup handles L<key>[\t<username>]
+func (c *dictConn) lookup(ctx context.Context, key string) error {
+	username, found := strings.CutPrefix(key, dictKeyPrefix)
+	if !found || username == "" {
+		return c.writeLine("N")
+	}
+
+	backend, err := c.store.Lookup(ctx, username)
+	if err != nil {
+		return c.writeLine("F" + err.Error())
+	}
+
+	if backend == "" {
+		return c.writeLine("N")
+	}
+
+	return c.writeLine("O" + backend)
+}
+
+// iterate handles I<flags>\t<max_rows>\t<path>[\t<username>]
+func (c *dictConn) iterate(ctx context.Context, args []string) error {
+	if len(args) < 3 {
+		return c.writeLine("FInvalid iterate request")
+	}
+
+	flags, _ := strconv.Atoi(args[0])
+	maxRows, _ := strconv.Atoi(args[1])
+	path := args[2]
+
+	if flags&dictIterateFlagExactKey == 0 && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	rows := 0
+
+	err := c.store.Iterate(ctx, allocator.Filter{}, func(mapping allocator.Mapping) error {
+		key := dictKeyPrefix + mapping.Username
+
+		if flags&dictIterateFlagExactKey != 0 {
+			if key != path {
+				return nil
+			}
+		} else if !strings.HasPrefix(key, path) {
+			return nil
+		}
+
+		value := mapping.Backend
+		if flags&dictIterateFlagNoValue != 0 {
+			value = ""
+		}
+
+		if err := c.writeLine("O"+key, value); err != nil {
+			return err
+		}
+
+		rows++
+		if maxRows > 0 && rows == maxRows {
+			return errMaxRows
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMaxRows) {
+		return c.writeLine("F" + err.Error())
+	}
+
+	return c.writeLine("")
+}
+
+// commit handles C<id> and D<id>, only transactions without changes succeed
+func (c *dictConn) commit(id string) error {
+	changed := c.transactions[id]
+	delete(c.transactions, id)
+
+	if changed {
+		return c.writeLine("F"+id, "director dict is read-only")
+	}
+
+	return c.writeLine("O" + id)
+}
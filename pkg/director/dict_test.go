@@ -0,0 +1,121 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDict(t *testing.T) {
+	d := New(staticAllocator{
+		"user@example.com":  "10.0.0.1",
+		"other@example.org": "10.0.0.2",
+	})
+
+	tests := []struct {
+		name    string
+		request string
+		reply   []string
+	}{
+		{
+			name:    "lookup",
+			request: "Lshared/director/user@example.com",
+			reply:   []string{"O10.0.0.1"},
+		},
+		{
+			name:    "lookup unknown",
+			request: "Lshared/director/nobody@example.com",
+			reply:   []string{"N"},
+		},
+		{
+			name:    "lookup other namespace",
+			request: "Lpriv/user@example.com",
+			reply:   []string{"N"},
+		},
+		{
+			name:    "iterate",
+			request: "I0\t0\tshared/director",
+			reply: []string{
+				"Oshared/director/other@example.org\t10.0.0.2",
+				"Oshared/director/user@example.com\t10.0.0.1",
+				"",
+			},
+		},
+		{
+			name:    "iterate max rows",
+			request: "I0\t1\tshared/director/",
+			reply:   []string{"Oshared/director/other@example.org\t10.0.0.2", ""},
+		},
+		{
+			name:    "iterate exact key without value",
+			request: "I24\t0\tshared/director/user@example.com",
+			reply:   []string{"Oshared/director/user@example.com\t", ""},
+		},
+		{
+			name:    "commit without changes",
+			request: "B1\nC1",
+			reply:   []string{"O1"},
+		},
+		{
+			name:    "commit with changes",
+			request: "B2\nS2\tshared/director/user@example.com\t10.0.0.3\nC2",
+			reply:   []string{"F2\tdirector dict is read-only"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go d.handleDict(ctx, server)
+
+			c := newLineConn(client)
+			go c.conn.Write([]byte("H3\t2\t0\t\tdirector\n" + tt.request + "\n"))
+
+			for i, want := range tt.reply {
+				args, err := c.readLine()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if reply := strings.Join(args, "\t"); reply != want {
+					t.Errorf("reply %d = %q, want %q", i, reply, want)
+				}
+			}
+		})
+	}
+}
@@ -40,6 +40,9 @@ import (
 
 	"go-dovecot-director/pkg/allocator"
 	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/overrides"
+	"go-dovecot-director/pkg/pool"
 )
 
 const (
@@ -49,12 +52,59 @@ const (
 
 type Director struct {
 	allocator allocator.Allocator
+	pool      pool.Pool
+
+	lmtpPort  int
+	policy    *policy
+	proxyMode ProxyMode
+	referral  ReferralConfig
+	chain     ChainConfig
+	version   dovecot.Version
+	publicUrl string
+	token     string
+
+	// adminToken is required on the management listener, writes are
+	// refused without one
+	adminToken string
+
+	// nginxPorts are the backend ports by nginx mail protocol
+	nginxPorts map[string]int
+
+	// routingTemplate expands to the routing key, the user if nil
+	routingTemplate *dovecot.Template
+	normalization   NormalizeConfig
+
+	mailboxes       mailbox.Store
+	resolver        mailbox.Resolver
+	verifyPasswords bool
+	checkStatus     bool
+
+	overrides overrides.Store
+
+	userdb         bool
+	userdbDefaults UserdbTemplates
+	userdbBackends map[string]UserdbTemplates
+
+	proxyDefaults dovecot.ProxyAttributes
+	proxyBackends map[string]dovecot.ProxyAttributes
+	services      map[string]ServiceConfig
 }
 
-func New(allocator allocator.Allocator) *Director {
-	return &Director{
-		allocator: allocator,
+func New(allocator allocator.Allocator, opts ...Option) *Director {
+	d := &Director{
+		allocator:  allocator,
+		lmtpPort:   24,
+		nginxPorts: defaultNginxPorts(),
+		policy:     newPolicy(PolicyConfig{}),
+		version:    dovecot.Version23,
+		services:   map[string]ServiceConfig{},
 	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
 }
 
 func (d *Director) Serve(ctx context.Context, l net.Listener) error {
@@ -66,9 +116,21 @@ func (d *Director) Serve(ctx context.Context, l net.Listener) error {
 	mux.HandleFunc(authUserdbLookupUri, func(w http.ResponseWriter, r *http.Request) {
 		d.authUserdbLookup(ctx, w, r)
 	})
+	mux.HandleFunc(authUserdbIterateUri, func(w http.ResponseWriter, r *http.Request) {
+		d.authUserdbIterate(ctx, w, r)
+	})
+	mux.HandleFunc(nginxAuthUri, func(w http.ResponseWriter, r *http.Request) {
+		d.nginxAuth(ctx, w, r)
+	})
+	mux.HandleFunc(authPolicyUri, func(w http.ResponseWriter, r *http.Request) {
+		d.authPolicy(ctx, w, r)
+	})
+	mux.HandleFunc(dovecotConfigUri, func(w http.ResponseWriter, r *http.Request) {
+		d.dovecotConfig(ctx, w, r)
+	})
 
 	server := http.Server{
-		Handler: mux,
+		Handler: authorize(d.token, mux),
 	}
 
 	go func() {
@@ -80,49 +142,67 @@ func (d *Director) Serve(ctx context.Context, l net.Listener) error {
 	return server.Serve(l)
 }
 
-func (d *Director) redirect(ctx context.Context, w http.ResponseWriter, r *http.Request) (*dovecot.ResponseAttributes, bool) {
+func (d *Director) redirect(ctx context.Context, r *http.Request, lookup func(context.Context, *dovecot.Request) (*dovecot.ResponseAttributes, error)) (*dovecot.ResponseAttributes, error) {
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 	if err != nil {
-		log.Print(err)
-
-		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
 
-		return nil, false
+	authRequest, err := dovecot.ParseRequest(body)
+	if err != nil {
+		return nil, err
 	}
 
-	var authRequest dovecot.Request
-	if err = json.Unmarshal(body, &authRequest); err != nil {
-		log.Printf("Failed parsing request: %+v", err)
+	return lookup(ctx, authRequest)
+}
+
+// lookup routes a request and returns its proxy attributes, the overrides
+// of db are merged into them
+func (d *Director) lookup(ctx context.Context, db overrides.Database, authRequest *dovecot.Request) (*dovecot.ResponseAttributes, error) {
+	return d.proxyLookup(ctx, db, authRequest, false)
+}
+
+// proxyLookup routes a request, verifying its password if asked for, and
+// returns its proxy attributes with the overrides of db merged
+func (d *Director) proxyLookup(ctx context.Context, db overrides.Database, authRequest *dovecot.Request, verifyPassword bool) (*dovecot.ResponseAttributes, error) {
+	r, err := d.route(ctx, authRequest, verifyPassword)
+	if err != nil {
+		return nil, err
+	}
 
-		w.WriteHeader(http.StatusBadRequest)
+	attrs := d.proxyAttributes(ctx, authRequest, r, verifyPassword)
+	attrs.User = r.user
 
-		return nil, false
+	if err = d.mergeOverrides(ctx, db, r, attrs); err != nil {
+		return nil, err
 	}
 
+	return attrs, nil
+}
+
+// allocate allocates a backend for the routing key of a request, retrying
+// on failures
+func (d *Director) allocate(ctx context.Context, authRequest *dovecot.Request, key string) (string, error) {
 	i := 0
 	for {
-		if backend, err := d.allocator.Allocate(ctx, authRequest.User); err == nil {
-			return &dovecot.ResponseAttributes{
-				Nopassword: true,
-				Proxy:      true,
-				Host:       backend,
-			}, true
-		} else {
-			log.Print(err)
+		backend, err := d.allocator.Allocate(ctx, key)
+		if err == nil {
+			err = d.checkService(ctx, authRequest.Service, backend)
+		}
+		if err == nil {
+			return backend, nil
 		}
 
+		log.Print(err)
+
 		i++
 
-		if i == 5 {
-			break
+		if i == 5 || !retryable(err) {
+			return "", err
 		}
 
 		time.Sleep(time.Second)
 	}
-
-	w.WriteHeader(http.StatusInternalServerError)
-
-	return nil, false
 }
 
 func sendResponse(w http.ResponseWriter, reply any) {
@@ -142,8 +222,12 @@ func sendResponse(w http.ResponseWriter, reply any) {
 }
 
 func (d *Director) authPassdbLookup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	attrs, success := d.redirect(ctx, w, r)
-	if !success {
+	attrs, err := d.redirect(ctx, r, d.authenticateHTTP)
+	if err != nil {
+		log.Print(err)
+
+		sendResponse(w, d.passdbFailure(err))
+
 		return
 	}
 
@@ -152,12 +236,22 @@ func (d *Director) authPassdbLookup(ctx context.Context, w http.ResponseWriter,
 		Attributes: attrs,
 	}
 
+	// the following passdbs authenticate the user
+	if d.chain.Next {
+		response.Code = dovecot.PASSDB_RESULT_NEXT
+		attrs.Nopassword = false
+	}
+
 	sendResponse(w, response)
 }
 
 func (d *Director) authUserdbLookup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	attrs, success := d.redirect(ctx, w, r)
-	if !success {
+	attrs, err := d.redirect(ctx, r, d.userLookup)
+	if err != nil {
+		log.Print(err)
+
+		sendResponse(w, d.userdbFailure(err))
+
 		return
 	}
 
@@ -0,0 +1,128 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+)
+
+// staticAllocator allocates the backends of its users, others are unknown
+type staticAllocator map[string]string
+
+func (a staticAllocator) Allocate(ctx context.Context, user string) (string, error) {
+	backend, ok := a[user]
+	if !ok {
+		return "", allocator.ErrUserUnknown
+	}
+
+	return backend, nil
+}
+
+func (a staticAllocator) Lookup(ctx context.Context, user string) (string, error) {
+	return a[user], nil
+}
+
+func (a staticAllocator) Iterate(ctx context.Context, filter allocator.Filter, fn func(allocator.Mapping) error) error {
+	for _, user := range slices.Sorted(maps.Keys(a)) {
+		_, domain := dovecot.SplitUser(user)
+		if filter.Backend != "" && filter.Backend != a[user] || filter.Domain != "" && filter.Domain != domain {
+			continue
+		}
+
+		if err := fn(allocator.Mapping{Username: user, Backend: a[user]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// staticMailboxes holds mailboxes by user
+type staticMailboxes map[string]*mailbox.Mailbox
+
+func (m staticMailboxes) Get(ctx context.Context, user string) (*mailbox.Mailbox, error) {
+	if mb, ok := m[user]; ok {
+		return mb, nil
+	}
+
+	return nil, mailbox.ErrNotFound
+}
+
+// dial runs handle on one end of a pipe, and returns the other end after
+// reading lines up to and including the one starting with greeting
+func dial(t *testing.T, handle func(context.Context, net.Conn), greeting string) *lineConn {
+	t.Helper()
+
+	client, server := net.Pipe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		client.Close()
+	})
+
+	go handle(ctx, server)
+
+	c := newLineConn(client)
+	for {
+		args, err := c.readLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if args[0] == greeting {
+			return c
+		}
+	}
+}
+
+// exchange sends a raw line and returns the reply line
+func exchange(t *testing.T, c *lineConn, line string) string {
+	t.Helper()
+
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := c.readLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Join(args, "\t")
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+const dovecotConfigUri = "/dovecot_config/"
+
+// dovecotConfigFiles are the generated files by name
+var dovecotConfigFiles = map[string]func(io.Writer, dovecot.ScriptConfig) error{
+	"proxy.lua":    dovecot.WriteLua,
+	"dovecot.conf": dovecot.WriteConf,
+}
+
+// dovecotConfig serves the generated proxy.lua and dovecot.conf for the
+// version query parameter, defaulting to the configured one
+func (d *Director) dovecotConfig(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	write := dovecotConfigFiles[strings.TrimPrefix(r.URL.Path, dovecotConfigUri)]
+	if write == nil {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	config := dovecot.ScriptConfig{
+		URL:     d.publicUrl,
+		Token:   d.token,
+		LuaFile: "/etc/dovecot/proxy.lua",
+		Version: d.version,
+	}
+	if config.URL == "" {
+		config.URL = "http://" + r.Host
+	}
+
+	query := r.URL.Query()
+	if query.Has("version") {
+		version, err := dovecot.ParseVersion(query.Get("version"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		config.Version = version
+	}
+	if query.Has("lua_file") {
+		config.LuaFile = query.Get("lua_file")
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Print(err)
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var b bytes.Buffer
+	if err := write(&b, config); err != nil {
+		log.Print(err)
+
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Add("Content-type", "text/plain; charset=utf-8")
+	if _, err := w.Write(b.Bytes()); err != nil {
+		log.Print(err)
+	}
+}
+
+// authorize requires the bearer token on all requests if one is set
+func authorize(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
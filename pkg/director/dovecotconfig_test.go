@@ -0,0 +1,78 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestDovecotConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		contains string
+	}{
+		{name: "lua", path: "proxy.lua", status: http.StatusOK, contains: `local url = "http://director.example:8080"`},
+		{name: "conf", path: "dovecot.conf", status: http.StatusOK, contains: "args = file=/etc/dovecot/proxy.lua blocking=yes"},
+		{name: "conf 2.4", path: "dovecot.conf?version=2.4", status: http.StatusOK, contains: "lua_file = /etc/dovecot/proxy.lua\n"},
+		{name: "lua file", path: "dovecot.conf?lua_file=/usr/local/etc/proxy.lua", status: http.StatusOK, contains: "file=/usr/local/etc/proxy.lua "},
+		{name: "relative lua file", path: "dovecot.conf?lua_file=proxy.lua", status: http.StatusBadRequest},
+		{name: "lua file with arguments", path: "dovecot.conf?lua_file=" + url.QueryEscape("/etc/proxy.lua blocking=no"), status: http.StatusBadRequest},
+		{name: "lua file with newline", path: "dovecot.conf?lua_file=" + url.QueryEscape("/etc/proxy.lua\n}\npassdb static {"), status: http.StatusBadRequest},
+		{name: "invalid version", path: "proxy.lua?version=2.2", status: http.StatusBadRequest},
+		{name: "unknown file", path: "dovecot-ldap.conf", status: http.StatusNotFound},
+	}
+
+	d := New(staticAllocator{}, WithDovecotVersion(dovecot.Version23))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://director.example:8080"+dovecotConfigUri+tt.path, nil)
+			w := httptest.NewRecorder()
+
+			d.dovecotConfig(context.Background(), w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("missing %q in:\n%s", tt.contains, w.Body.String())
+			}
+		})
+	}
+}
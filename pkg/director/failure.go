@@ -0,0 +1,115 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"errors"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/password"
+)
+
+// userUnknown tells whether a lookup failed for the user not existing, being
+// disabled or invalid, as opposed to a failure of the director
+func userUnknown(err error) bool {
+	var requestErr *dovecot.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.Field == "user"
+	}
+
+	return errors.Is(err, allocator.ErrUserUnknown) || errors.Is(err, mailbox.ErrNotFound) || errors.Is(err, errUserDisabled) ||
+		errors.Is(err, errNotOwned)
+}
+
+// loginFailed tells whether a login failed for invalid credentials
+func loginFailed(err error) bool {
+	return userUnknown(err) || errors.Is(err, errPasswordMismatch)
+}
+
+// retryable tells whether a lookup may succeed when retried
+func retryable(err error) bool {
+	var requestErr *dovecot.RequestError
+
+	return !errors.As(err, &requestErr) && !errors.Is(err, allocator.ErrUserUnknown) && !errors.Is(err, allocator.ErrInternal) &&
+		!errors.Is(err, errNotOwned) && !errors.Is(err, errServiceUnavailable)
+}
+
+// failureAttributes returns the attributes of a failure response
+func (d *Director) failureAttributes(err error) *dovecot.ResponseAttributes {
+	return &dovecot.ResponseAttributes{
+		Reason:  err.Error(),
+		Version: d.version,
+	}
+}
+
+// passdbFailure returns the passdb response for a failed lookup
+func (d *Director) passdbFailure(err error) *dovecot.PassdbResponse {
+	code := dovecot.PASSDB_RESULT_INTERNAL_FAILURE
+	switch {
+	case d.chain.next(err):
+		code = dovecot.PASSDB_RESULT_NEXT
+	case errors.Is(err, errUserDisabled):
+		code = dovecot.PASSDB_RESULT_USER_DISABLED
+	case userUnknown(err):
+		code = dovecot.PASSDB_RESULT_USER_UNKNOWN
+	case errors.Is(err, errPasswordMismatch):
+		code = dovecot.PASSDB_RESULT_PASSWORD_MISMATCH
+	case errors.Is(err, password.ErrUnknownScheme):
+		code = dovecot.PASSDB_RESULT_SCHEME_NOT_AVAILABLE
+	}
+
+	// fields returned with NEXT are passed on to the following passdbs
+	if code == dovecot.PASSDB_RESULT_NEXT {
+		return &dovecot.PassdbResponse{
+			Code:       code,
+			Attributes: &dovecot.ResponseAttributes{Version: d.version},
+		}
+	}
+
+	return &dovecot.PassdbResponse{
+		Code:       code,
+		Attributes: d.failureAttributes(err),
+	}
+}
+
+// userdbFailure returns the userdb response for a failed lookup
+func (d *Director) userdbFailure(err error) *dovecot.UserdbResponse {
+	code := dovecot.USERDB_RESULT_INTERNAL_FAILURE
+	if userUnknown(err) {
+		code = dovecot.USERDB_RESULT_USER_UNKNOWN
+	}
+
+	return &dovecot.UserdbResponse{
+		Code:       code,
+		Attributes: d.failureAttributes(err),
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"fmt"
+	"testing"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/password"
+)
+
+func TestFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		chain     ChainConfig
+		err       error
+		passdb    dovecot.PassdbResult
+		userdb    dovecot.UserdbResult
+		reason    string
+		allocate  bool
+		retryable bool
+	}{
+		{
+			name:     "user unknown",
+			allocate: true,
+			err:      allocator.ErrUserUnknown,
+			passdb:   dovecot.PASSDB_RESULT_USER_UNKNOWN,
+			userdb:   dovecot.USERDB_RESULT_USER_UNKNOWN,
+			reason:   "user unknown",
+		},
+		{
+			name:   "mailbox not found",
+			err:    mailbox.ErrNotFound,
+			passdb: dovecot.PASSDB_RESULT_USER_UNKNOWN,
+			userdb: dovecot.USERDB_RESULT_USER_UNKNOWN,
+			reason: "mailbox not found",
+		},
+		{
+			name:   "user disabled",
+			err:    fmt.Errorf("%w: domain example.com is disabled", errUserDisabled),
+			passdb: dovecot.PASSDB_RESULT_USER_DISABLED,
+			userdb: dovecot.USERDB_RESULT_USER_UNKNOWN,
+			reason: "user disabled: domain example.com is disabled",
+		},
+		{
+			name:   "password mismatch",
+			err:    errPasswordMismatch,
+			passdb: dovecot.PASSDB_RESULT_PASSWORD_MISMATCH,
+			userdb: dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason: "password mismatch",
+		},
+		{
+			name:   "unknown scheme",
+			err:    password.ErrUnknownScheme,
+			passdb: dovecot.PASSDB_RESULT_SCHEME_NOT_AVAILABLE,
+			userdb: dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason: "unknown password scheme",
+		},
+		{
+			name:   "invalid user",
+			err:    &dovecot.RequestError{Field: "user", Reason: "empty"},
+			passdb: dovecot.PASSDB_RESULT_USER_UNKNOWN,
+			userdb: dovecot.USERDB_RESULT_USER_UNKNOWN,
+			reason: (&dovecot.RequestError{Field: "user", Reason: "empty"}).Error(),
+		},
+		{
+			name:   "invalid field",
+			err:    &dovecot.RequestError{Field: "lport", Reason: "invalid port"},
+			passdb: dovecot.PASSDB_RESULT_INTERNAL_FAILURE,
+			userdb: dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason: (&dovecot.RequestError{Field: "lport", Reason: "invalid port"}).Error(),
+		},
+		{
+			name:   "request error without field",
+			err:    &dovecot.RequestError{Reason: "invalid json"},
+			passdb: dovecot.PASSDB_RESULT_INTERNAL_FAILURE,
+			userdb: dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason: (&dovecot.RequestError{Reason: "invalid json"}).Error(),
+		},
+		{
+			name:      "temporary",
+			allocate:  true,
+			err:       fmt.Errorf("%w: connection refused", allocator.ErrTemporary),
+			passdb:    dovecot.PASSDB_RESULT_INTERNAL_FAILURE,
+			userdb:    dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason:    "temporary failure: connection refused",
+			retryable: true,
+		},
+		{
+			name:      "no backends",
+			allocate:  true,
+			err:       allocator.ErrNoBackends,
+			passdb:    dovecot.PASSDB_RESULT_INTERNAL_FAILURE,
+			userdb:    dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason:    "no backends are available",
+			retryable: true,
+		},
+		{
+			name:     "internal",
+			allocate: true,
+			err:      fmt.Errorf("%w: undefined table", allocator.ErrInternal),
+			passdb:   dovecot.PASSDB_RESULT_INTERNAL_FAILURE,
+			userdb:   dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason:   "internal error: undefined table",
+		},
+		{
+			name:     "service unavailable",
+			allocate: true,
+			err:      fmt.Errorf("%w: 10.0.0.1 for lmtp", errServiceUnavailable),
+			passdb:   dovecot.PASSDB_RESULT_INTERNAL_FAILURE,
+			userdb:   dovecot.USERDB_RESULT_INTERNAL_FAILURE,
+			reason:   "backend does not serve the service: 10.0.0.1 for lmtp",
+		},
+		{
+			name:   "not owned",
+			err:    errNotOwned,
+			passdb: dovecot.PASSDB_RESULT_NEXT,
+			userdb: dovecot.USERDB_RESULT_USER_UNKNOWN,
+		},
+		{
+			name:   "next unknown",
+			chain:  ChainConfig{NextUnknown: true},
+			err:    allocator.ErrUserUnknown,
+			passdb: dovecot.PASSDB_RESULT_NEXT,
+			userdb: dovecot.USERDB_RESULT_USER_UNKNOWN,
+		},
+		{
+			name:   "next unknown disabled",
+			chain:  ChainConfig{NextUnknown: true},
+			err:    errUserDisabled,
+			passdb: dovecot.PASSDB_RESULT_USER_DISABLED,
+			userdb: dovecot.USERDB_RESULT_USER_UNKNOWN,
+			reason: "user disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(staticAllocator{}, WithChaining(tt.chain))
+
+			passdb := d.passdbFailure(tt.err)
+			if passdb.Code != tt.passdb || passdb.Attributes.Reason != tt.reason {
+				t.Errorf("passdb code %d reason %q, want %d %q", passdb.Code, passdb.Attributes.Reason, tt.passdb, tt.reason)
+			}
+
+			userdb := d.userdbFailure(tt.err)
+			if userdb.Code != tt.userdb || userdb.Attributes.Reason != tt.err.Error() {
+				t.Errorf("userdb code %d reason %q, want %d %q", userdb.Code, userdb.Attributes.Reason, tt.userdb, tt.err.Error())
+			}
+
+			// only allocation errors are retried
+			if tt.allocate && retryable(tt.err) != tt.retryable {
+				t.Errorf("retryable = %v", !tt.retryable)
+			}
+		})
+	}
+}
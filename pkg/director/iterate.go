@@ -0,0 +1,98 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go-dovecot-director/pkg/allocator"
+)
+
+const authUserdbIterateUri = "/auth_userdb_iterate"
+
+// authUserdbIterate streams all users as a json array, optionally filtered by
+// the backend and domain query parameters
+func (d *Director) authUserdbIterate(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	store, ok := d.allocator.(allocator.Store)
+	if !ok {
+		log.Print(errStoreNotSupported)
+
+		w.WriteHeader(http.StatusNotImplemented)
+
+		return
+	}
+
+	filter := allocator.Filter{
+		Backend: r.URL.Query().Get("backend"),
+		Domain:  r.URL.Query().Get("domain"),
+	}
+
+	w.Header().Add("Content-type", "application/json")
+
+	separator := []byte("[")
+	flusher, _ := w.(http.Flusher)
+
+	n := 0
+	err := store.Iterate(ctx, filter, func(mapping allocator.Mapping) error {
+		username, err := json.Marshal(mapping.Username)
+		if err != nil {
+			return err
+		}
+
+		if _, err = w.Write(append(separator, username...)); err != nil {
+			return err
+		}
+		separator = []byte(",")
+
+		if n++; n%1000 == 0 && flusher != nil {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		// the response is left incomplete, so that the client notices
+		log.Print(err)
+
+		if n == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if n == 0 {
+		w.Write(separator)
+	}
+	w.Write([]byte("]"))
+}
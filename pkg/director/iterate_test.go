@@ -0,0 +1,111 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-dovecot-director/pkg/allocator"
+)
+
+// failingStore iterates its users, then fails
+type failingStore []string
+
+func (s failingStore) Allocate(ctx context.Context, user string) (string, error) {
+	return "", allocator.ErrTemporary
+}
+
+func (s failingStore) Lookup(ctx context.Context, user string) (string, error) {
+	return "", allocator.ErrTemporary
+}
+
+func (s failingStore) Iterate(ctx context.Context, filter allocator.Filter, fn func(allocator.Mapping) error) error {
+	for _, user := range s {
+		if err := fn(allocator.Mapping{Username: user, Backend: "10.0.0.1"}); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("connection lost")
+}
+
+// allocatorOnly cannot enumerate its mappings
+type allocatorOnly struct{}
+
+func (allocatorOnly) Allocate(ctx context.Context, user string) (string, error) {
+	return "", allocator.ErrTemporary
+}
+
+func TestAuthUserdbIterate(t *testing.T) {
+	users := staticAllocator{
+		"a@example.com": "10.0.0.1",
+		"b@example.com": "10.0.0.2",
+		"c@example.org": "10.0.0.1",
+	}
+
+	tests := []struct {
+		name      string
+		allocator allocator.Allocator
+		query     string
+		status    int
+		body      string
+	}{
+		{name: "all", allocator: users, status: http.StatusOK, body: `["a@example.com","b@example.com","c@example.org"]`},
+		{name: "empty", allocator: staticAllocator{}, status: http.StatusOK, body: `[]`},
+		{name: "backend", allocator: users, query: "?backend=10.0.0.1", status: http.StatusOK, body: `["a@example.com","c@example.org"]`},
+		{name: "domain", allocator: users, query: "?domain=example.com", status: http.StatusOK, body: `["a@example.com","b@example.com"]`},
+		{name: "no match", allocator: users, query: "?backend=10.0.0.2&domain=example.org", status: http.StatusOK, body: `[]`},
+		{name: "error before the first row", allocator: failingStore{}, status: http.StatusInternalServerError},
+		{name: "error after rows", allocator: failingStore{"a@example.com"}, status: http.StatusOK, body: `["a@example.com"`},
+		{name: "not supported", allocator: allocatorOnly{}, status: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(tt.allocator)
+
+			r := httptest.NewRequest(http.MethodGet, authUserdbIterateUri+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			d.authUserdbIterate(context.Background(), w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Body.String(); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
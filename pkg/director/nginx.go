@@ -0,0 +1,121 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+const nginxAuthUri = "/nginx_auth"
+
+// nginxServices maps nginx mail protocols to Dovecot services
+var nginxServices = map[string]string{
+	"imap": "imap",
+	"pop3": "pop3",
+	"smtp": "submission",
+}
+
+// defaultNginxPorts are the backend ports of the nginx mail protocols, used
+// unless configured or discovered
+func defaultNginxPorts() map[string]int {
+	return map[string]int{
+		"imap": 143,
+		"pop3": 110,
+		"smtp": 587,
+	}
+}
+
+// nginxAuth implements nginx's mail auth_http protocol
+func (d *Director) nginxAuth(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	protocol := r.Header.Get("Auth-Protocol")
+
+	service, ok := nginxServices[protocol]
+	if !ok {
+		w.Header().Set("Auth-Status", "Unsupported protocol")
+
+		return
+	}
+
+	// nginx escapes the user name and the password
+	user, userErr := url.PathUnescape(r.Header.Get("Auth-User"))
+	password, passErr := url.PathUnescape(r.Header.Get("Auth-Pass"))
+	if userErr != nil || passErr != nil {
+		w.Header().Set("Auth-Status", "Invalid login or password")
+		w.Header().Set("Auth-Wait", "3")
+
+		return
+	}
+
+	authRequest := &dovecot.Request{
+		Password: password,
+		Mech:     r.Header.Get("Auth-Method"),
+		Service:  service,
+	}
+	authRequest.SetUser(user)
+
+	var attrs *dovecot.ResponseAttributes
+
+	err := authRequest.Set("rip", r.Header.Get("Client-IP"))
+	if err == nil {
+		attrs, err = d.authenticate(ctx, authRequest)
+	}
+
+	if loginFailed(err) {
+		w.Header().Set("Auth-Status", "Invalid login or password")
+		w.Header().Set("Auth-Wait", "3")
+
+		return
+	}
+
+	if err != nil {
+		w.Header().Set("Auth-Status", "Temporary server problem, try again later")
+		w.Header().Set("Auth-Error-Code", "451 4.3.0")
+		w.Header().Set("Auth-Wait", "3")
+
+		return
+	}
+
+	port := d.nginxPorts[protocol]
+	if attrs.Port != 0 {
+		port = attrs.Port
+	}
+
+	w.Header().Set("Auth-Status", "OK")
+	w.Header().Set("Auth-Server", attrs.Host)
+	w.Header().Set("Auth-Port", strconv.Itoa(port))
+	if attrs.User != "" {
+		w.Header().Set("Auth-User", attrs.User)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNginxAuth(t *testing.T) {
+	verify := []Option{
+		WithPasswordVerification(true),
+		WithMailboxes(staticMailboxes{
+			"user@example.com": {Username: "user@example.com", Password: "{PLAIN}se cr%et", Active: true, DomainActive: true},
+		}),
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		protocol string
+		user     string
+		password string
+		headers  map[string]string
+	}{
+		{
+			name:     "imap",
+			protocol: "imap",
+			user:     "user@example.com",
+			headers:  map[string]string{"Auth-Status": "OK", "Auth-Server": "10.0.0.1", "Auth-Port": "143"},
+		},
+		{
+			name:     "smtp",
+			protocol: "smtp",
+			user:     "user@example.com",
+			headers:  map[string]string{"Auth-Status": "OK", "Auth-Server": "10.0.0.1", "Auth-Port": "587"},
+		},
+		{
+			name:     "configured port",
+			opts:     []Option{WithNginxPorts(map[string]int{"smtp": 25})},
+			protocol: "smtp",
+			user:     "user@example.com",
+			headers:  map[string]string{"Auth-Status": "OK", "Auth-Port": "25"},
+		},
+		{
+			name:     "unknown user",
+			protocol: "imap",
+			user:     "nobody@example.com",
+			headers:  map[string]string{"Auth-Status": "Invalid login or password", "Auth-Wait": "3"},
+		},
+		{
+			name:     "escaped user",
+			protocol: "imap",
+			user:     "user%40example.com",
+			headers:  map[string]string{"Auth-Status": "OK", "Auth-Server": "10.0.0.1"},
+		},
+		{
+			name:     "escaped password",
+			opts:     verify,
+			protocol: "imap",
+			user:     "user@example.com",
+			password: "se%20cr%25et",
+			headers:  map[string]string{"Auth-Status": "OK", "Auth-Server": "10.0.0.1"},
+		},
+		{
+			name:     "unescaped password",
+			opts:     verify,
+			protocol: "imap",
+			user:     "user@example.com",
+			password: "se cr%et",
+			headers:  map[string]string{"Auth-Status": "Invalid login or password"},
+		},
+		{
+			name:     "invalid escape",
+			protocol: "imap",
+			user:     "user%zz",
+			headers:  map[string]string{"Auth-Status": "Invalid login or password", "Auth-Wait": "3"},
+		},
+		{
+			name:     "unsupported protocol",
+			protocol: "xmpp",
+			user:     "user@example.com",
+			headers:  map[string]string{"Auth-Status": "Unsupported protocol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(staticAllocator{"user@example.com": "10.0.0.1"}, tt.opts...)
+
+			r := httptest.NewRequest(http.MethodGet, nginxAuthUri, nil)
+			r.Header.Set("Auth-Protocol", tt.protocol)
+			r.Header.Set("Auth-User", tt.user)
+			password := tt.password
+			if password == "" {
+				password = "secret"
+			}
+			r.Header.Set("Auth-Pass", password)
+			r.Header.Set("Client-IP", "192.0.2.1")
+
+			w := httptest.NewRecorder()
+			d.nginxAuth(context.Background(), w, r)
+
+			for key, value := range tt.headers {
+				if got := w.Header().Get(key); got != value {
+					t.Errorf("%s = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
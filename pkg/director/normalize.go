@@ -0,0 +1,125 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// NormalizeConfig selects the steps canonicalizing user names before a
+// backend is allocated
+type NormalizeConfig struct {
+	// TrimSpace removes leading and trailing white space
+	TrimSpace bool
+
+	// Lowercase folds the user name to lower case
+	Lowercase bool
+
+	// IDNA converts internationalized domains to their punycode form
+	IDNA bool
+
+	// RecipientDelimiter strips the extension of the local part starting
+	// with any of its characters, like Postfix's recipient_delimiter
+	RecipientDelimiter string
+
+	// DefaultDomain is appended to user names without a domain
+	DefaultDomain string
+}
+
+// normalizeUser returns the canonical form of user
+func (c *NormalizeConfig) normalizeUser(user string) (string, error) {
+	if c.TrimSpace {
+		user = strings.TrimSpace(user)
+	}
+	if c.Lowercase {
+		user = strings.ToLower(user)
+	}
+
+	username, domain := dovecot.SplitUser(user)
+	hasDomain := strings.Contains(user, "@")
+
+	if c.RecipientDelimiter != "" {
+		if i := strings.IndexAny(username, c.RecipientDelimiter); i > 0 {
+			username = username[:i]
+		}
+	}
+
+	if !hasDomain && c.DefaultDomain != "" {
+		domain = c.DefaultDomain
+		hasDomain = true
+	}
+
+	if c.IDNA && domain != "" {
+		ascii, err := idna.Lookup.ToASCII(domain)
+		if err != nil {
+			return "", &dovecot.RequestError{Field: "user", Reason: "invalid domain"}
+		}
+
+		domain = ascii
+	}
+
+	if !hasDomain {
+		return username, nil
+	}
+
+	return username + "@" + domain, nil
+}
+
+// Normalize replaces the user names of a request with their canonical
+// forms
+func (c *NormalizeConfig) Normalize(authRequest *dovecot.Request) error {
+	if *c == (NormalizeConfig{}) {
+		return nil
+	}
+
+	user, err := c.normalizeUser(authRequest.User)
+	if err != nil {
+		return err
+	}
+
+	if user != authRequest.User {
+		authRequest.SetUser(user)
+	}
+
+	if authRequest.LoginUser == "" {
+		return nil
+	}
+
+	if authRequest.LoginUser, err = c.normalizeUser(authRequest.LoginUser); err != nil {
+		return err
+	}
+	authRequest.LoginUsername, authRequest.LoginDomain = dovecot.SplitUser(authRequest.LoginUser)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"errors"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestNormalizeUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		config NormalizeConfig
+		user   string
+		want   string
+		err    bool
+	}{
+		{name: "unchanged", user: " A+x@Example.com", want: " A+x@Example.com"},
+		{name: "trim space", config: NormalizeConfig{TrimSpace: true}, user: " a@example.com\t", want: "a@example.com"},
+		{name: "lowercase", config: NormalizeConfig{Lowercase: true}, user: "A@Example.COM", want: "a@example.com"},
+		{name: "recipient delimiter", config: NormalizeConfig{RecipientDelimiter: "+-"}, user: "a-b+c@example.com", want: "a@example.com"},
+		{name: "leading delimiter", config: NormalizeConfig{RecipientDelimiter: "+"}, user: "+a@example.com", want: "+a@example.com"},
+		{name: "delimiter without domain", config: NormalizeConfig{RecipientDelimiter: "+"}, user: "a+b", want: "a"},
+		{name: "default domain", config: NormalizeConfig{DefaultDomain: "example.com"}, user: "a", want: "a@example.com"},
+		{name: "default domain with domain", config: NormalizeConfig{DefaultDomain: "example.com"}, user: "a@example.org", want: "a@example.org"},
+		{name: "idna", config: NormalizeConfig{IDNA: true}, user: "a@bücher.example", want: "a@xn--bcher-kva.example"},
+		{name: "idna default domain", config: NormalizeConfig{IDNA: true, DefaultDomain: "bücher.example"}, user: "a", want: "a@xn--bcher-kva.example"},
+		{name: "idna invalid domain", config: NormalizeConfig{IDNA: true}, user: "a@exa mple.com", err: true},
+		{
+			name:   "all steps",
+			config: NormalizeConfig{TrimSpace: true, Lowercase: true, IDNA: true, RecipientDelimiter: "+"},
+			user:   " A+Tag@BÜCHER.example ",
+			want:   "a@xn--bcher-kva.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.normalizeUser(tt.user)
+			if tt.err {
+				var requestError *dovecot.RequestError
+				if !errors.As(err, &requestError) {
+					t.Errorf("err = %v, want a RequestError", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	config := NormalizeConfig{Lowercase: true, DefaultDomain: "example.com"}
+
+	tests := []struct {
+		name    string
+		request dovecot.Request
+		want    dovecot.Request
+	}{
+		{
+			name:    "user",
+			request: dovecot.Request{User: "A"},
+			want:    dovecot.Request{User: "a@example.com", Username: "a", Domain: "example.com"},
+		},
+		{
+			name:    "login user",
+			request: dovecot.Request{User: "A@Example.org", LoginUser: "Master"},
+			want: dovecot.Request{
+				User: "a@example.org", Username: "a", Domain: "example.org",
+				LoginUser: "master@example.com", LoginUsername: "master", LoginDomain: "example.com",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+			request.SetUser(request.User)
+
+			if err := config.Normalize(&request); err != nil {
+				t.Fatal(err)
+			}
+
+			if request.User != tt.want.User || request.Username != tt.want.Username || request.Domain != tt.want.Domain {
+				t.Errorf("got user %q (%q, %q), want %q (%q, %q)", request.User, request.Username, request.Domain, tt.want.User, tt.want.Username, tt.want.Domain)
+			}
+			if request.LoginUser != tt.want.LoginUser || request.LoginUsername != tt.want.LoginUsername || request.LoginDomain != tt.want.LoginDomain {
+				t.Errorf("got login user %q (%q, %q), want %q (%q, %q)", request.LoginUser, request.LoginUsername, request.LoginDomain, tt.want.LoginUser, tt.want.LoginUsername, tt.want.LoginDomain)
+			}
+		})
+	}
+}
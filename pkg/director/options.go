@@ -0,0 +1,201 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"maps"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+	"go-dovecot-director/pkg/overrides"
+	"go-dovecot-director/pkg/pool"
+)
+
+// Option configures optional Director behaviour
+type Option func(*Director)
+
+// WithPool sets the pool of the backends, used for discovering their ports
+func WithPool(p pool.Pool) Option {
+	return func(d *Director) {
+		d.pool = p
+	}
+}
+
+// WithMailboxes sets the store of mailboxes
+func WithMailboxes(store mailbox.Store) Option {
+	return func(d *Director) {
+		d.mailboxes = store
+	}
+}
+
+// WithRoutingKey sets the template of the name backends are allocated for
+func WithRoutingKey(t *dovecot.Template) Option {
+	return func(d *Director) {
+		d.routingTemplate = t
+	}
+}
+
+// WithNormalization sets the steps canonicalizing user names
+func WithNormalization(config NormalizeConfig) Option {
+	return func(d *Director) {
+		d.normalization = config
+	}
+}
+
+// WithResolver sets the resolver of alias addresses, requests are routed
+// on the mailboxes they resolve to
+func WithResolver(resolver mailbox.Resolver) Option {
+	return func(d *Director) {
+		d.resolver = resolver
+	}
+}
+
+// WithPublicURL sets the URL of the director in the generated Lua script,
+// the host of the request is used if empty
+func WithPublicURL(url string) Option {
+	return func(d *Director) {
+		d.publicUrl = url
+	}
+}
+
+// WithToken requires the bearer token on all HTTP requests, the generated
+// Lua script sends it
+func WithToken(token string) Option {
+	return func(d *Director) {
+		d.token = token
+	}
+}
+
+// WithChaining sets how the director takes part in a passdb chain
+func WithChaining(config ChainConfig) Option {
+	return func(d *Director) {
+		d.chain = config
+	}
+}
+
+// WithAdminToken sets the bearer token required on the management listener
+func WithAdminToken(token string) Option {
+	return func(d *Director) {
+		d.adminToken = token
+	}
+}
+
+// WithPasswordVerification enables verifying passwords against the hashes of
+// the mailboxes, needs WithMailboxes
+func WithPasswordVerification(enabled bool) Option {
+	return func(d *Director) {
+		d.verifyPasswords = enabled
+	}
+}
+
+// WithStatusCheck enables rejecting users of inactive mailboxes and
+// domains, needs WithMailboxes
+func WithStatusCheck(enabled bool) Option {
+	return func(d *Director) {
+		d.checkStatus = enabled
+	}
+}
+
+// WithUserdb makes userdb lookups return the userdb fields of mailboxes
+// instead of the proxy attributes, with templates for all backends and
+// overrides for individual ones. Needs WithMailboxes.
+func WithUserdb(defaults UserdbTemplates, backends map[string]UserdbTemplates) Option {
+	return func(d *Director) {
+		d.userdb = true
+		d.userdbDefaults = defaults
+		d.userdbBackends = backends
+	}
+}
+
+// WithOverrides sets the store of extra field overrides
+func WithOverrides(store overrides.Store) Option {
+	return func(d *Director) {
+		d.overrides = store
+	}
+}
+
+// WithLMTPPort sets the backend LMTP port used in Postfix transports
+func WithLMTPPort(port int) Option {
+	return func(d *Director) {
+		d.lmtpPort = port
+	}
+}
+
+// WithNginxPorts sets the backend ports returned to nginx by mail protocol,
+// e.g. smtp, unless the pool knows the ports of the backend
+func WithNginxPorts(ports map[string]int) Option {
+	return func(d *Director) {
+		maps.Copy(d.nginxPorts, ports)
+	}
+}
+
+// WithPolicy configures throttling of the auth policy endpoint
+func WithPolicy(config PolicyConfig) Option {
+	return func(d *Director) {
+		d.policy = newPolicy(config)
+	}
+}
+
+// WithProxyMode sets how frontends are told to proxy to backends
+func WithProxyMode(mode ProxyMode) Option {
+	return func(d *Director) {
+		d.proxyMode = mode
+	}
+}
+
+// WithReferral configures clients receiving login referrals
+func WithReferral(config ReferralConfig) Option {
+	return func(d *Director) {
+		d.referral = config
+	}
+}
+
+// WithDovecotVersion sets the Dovecot version attributes are serialized for
+func WithDovecotVersion(version dovecot.Version) Option {
+	return func(d *Director) {
+		d.version = version
+	}
+}
+
+// WithProxyAttributes sets proxy attributes returned for all backends, and
+// overrides for individual backends
+func WithProxyAttributes(defaults dovecot.ProxyAttributes, backends map[string]dovecot.ProxyAttributes) Option {
+	return func(d *Director) {
+		d.proxyDefaults = defaults
+		d.proxyBackends = backends
+	}
+}
+
+// WithService configures routing of a Dovecot service
+func WithService(service string, config ServiceConfig) Option {
+	return func(d *Director) {
+		d.services[service] = config
+	}
+}
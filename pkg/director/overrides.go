@@ -0,0 +1,180 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/overrides"
+)
+
+const overridesUri = "/overrides"
+
+// mergeOverrides merges the overrides of db for the target mailbox and
+// backend of r into the extra fields of attrs
+func (d *Director) mergeOverrides(ctx context.Context, db overrides.Database, r *route, attrs *dovecot.ResponseAttributes) error {
+	if d.overrides == nil {
+		return nil
+	}
+
+	_, domain := dovecot.SplitUser(r.target)
+
+	fields, err := d.overrides.Fields(ctx, db, r.target, domain, r.backend)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	// Extra may be shared with the configured attributes
+	extra := make(map[string]string, len(attrs.Extra)+len(fields))
+	maps.Copy(extra, attrs.Extra)
+	for key, value := range fields {
+		// stored before keys were restricted
+		if !overrides.Allowed(key) {
+			log.Printf("ignoring override of %s", key)
+
+			continue
+		}
+
+		extra[key] = value
+	}
+	attrs.Extra = extra
+
+	return nil
+}
+
+// ServeAdmin serves the management API, separately from the listener of
+// the proxies
+func (d *Director) ServeAdmin(ctx context.Context, l net.Listener) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(overridesUri, func(w http.ResponseWriter, r *http.Request) {
+		d.manageOverrides(ctx, w, r)
+	})
+
+	server := http.Server{
+		Handler: authorize(d.adminToken, mux),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		server.Close()
+	}()
+
+	return server.Serve(l)
+}
+
+// manageOverrides lists overrides on GET, filtered by the scope and name
+// query parameters, and sets or deletes the json encoded override in the
+// body on PUT and DELETE. Changes need the admin token to be set.
+func (d *Director) manageOverrides(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if d.overrides == nil {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		list, err := d.overrides.List(ctx, overrides.Filter{
+			Scope: overrides.Scope(r.URL.Query().Get("scope")),
+			Name:  r.URL.Query().Get("name"),
+		})
+		if err != nil {
+			log.Print(err)
+
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		if list == nil {
+			list = []overrides.Override{}
+		}
+
+		sendResponse(w, list)
+
+		return
+	}
+
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if d.adminToken == "" {
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		log.Print(err)
+
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	override := overrides.Override{Database: overrides.DatabaseAll}
+	if err = json.Unmarshal(body, &override); err == nil {
+		err = override.Validate()
+	}
+	if err != nil {
+		log.Printf("Invalid override: %+v", err)
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		err = d.overrides.Set(ctx, override)
+	} else {
+		err = d.overrides.Delete(ctx, override)
+	}
+	if err != nil {
+		log.Print(err)
+
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/overrides"
+)
+
+// staticOverrides returns fixed fields, records what they were asked for
+// and counts changes
+type staticOverrides struct {
+	fields  map[string]string
+	asked   []string
+	changes int
+}
+
+func (s *staticOverrides) Fields(ctx context.Context, db overrides.Database, user, domain, backend string) (map[string]string, error) {
+	s.asked = []string{user, domain, backend}
+
+	return s.fields, nil
+}
+
+func (s *staticOverrides) List(ctx context.Context, filter overrides.Filter) ([]overrides.Override, error) {
+	return nil, nil
+}
+
+func (s *staticOverrides) Set(ctx context.Context, o overrides.Override) error {
+	s.changes++
+
+	return nil
+}
+
+func (s *staticOverrides) Delete(ctx context.Context, o overrides.Override) error {
+	s.changes++
+
+	return nil
+}
+
+func TestServeAdmin(t *testing.T) {
+	const body = `{"scope": "domain", "name": "example.com", "key": "allow_nets", "value": "192.0.2.0/24"}`
+
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		method        string
+		body          string
+		status        int
+		changed       bool
+	}{
+		{name: "list without token", method: http.MethodGet, status: http.StatusOK},
+		{name: "set without token", method: http.MethodPut, body: body, status: http.StatusForbidden},
+		{name: "delete without token", method: http.MethodDelete, body: body, status: http.StatusForbidden},
+		{name: "set unauthorized", adminToken: "admin", method: http.MethodPut, body: body, status: http.StatusUnauthorized},
+		{name: "set with api token", adminToken: "admin", authorization: "Bearer api", method: http.MethodPut, body: body, status: http.StatusUnauthorized},
+		{name: "set", adminToken: "admin", authorization: "Bearer admin", method: http.MethodPut, body: body, status: http.StatusNoContent, changed: true},
+		{name: "delete", adminToken: "admin", authorization: "Bearer admin", method: http.MethodDelete, body: body, status: http.StatusNoContent, changed: true},
+		{
+			name:          "set host",
+			adminToken:    "admin",
+			authorization: "Bearer admin",
+			method:        http.MethodPut,
+			body:          `{"scope": "user", "name": "a@example.com", "key": "host", "value": "192.0.2.1"}`,
+			status:        http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &staticOverrides{}
+			d := New(staticAllocator{}, WithOverrides(store), WithToken("api"), WithAdminToken(tt.adminToken))
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go d.ServeAdmin(ctx, l)
+
+			req, err := http.NewRequest(tt.method, "http://"+l.Addr().String()+overridesUri, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if changed := store.changes > 0; changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestMergeOverrides(t *testing.T) {
+	store := &staticOverrides{fields: map[string]string{
+		"allow_nets": "192.0.2.0/24",
+		"host":       "192.0.2.1",
+		"nopassword": "y",
+	}}
+	d := New(staticAllocator{}, WithOverrides(store))
+
+	attrs := &dovecot.ResponseAttributes{}
+	if err := d.mergeOverrides(context.Background(), overrides.DatabasePassdb, &route{key: "a", target: "a@example.com", backend: "10.0.0.1"}, attrs); err != nil {
+		t.Fatal(err)
+	}
+
+	// scopes are matched on the target mailbox, not the routing key
+	if want := []string{"a@example.com", "example.com", "10.0.0.1"}; !slices.Equal(store.asked, want) {
+		t.Errorf("asked for %q, want %q", store.asked, want)
+	}
+
+	if len(attrs.Extra) != 1 || attrs.Extra["allow_nets"] != "192.0.2.0/24" {
+		t.Errorf("got extra fields %v", attrs.Extra)
+	}
+}
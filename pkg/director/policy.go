@@ -0,0 +1,249 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const authPolicyUri = "/auth_policy"
+
+// PolicyConfig configures throttling of the auth policy endpoint
+type PolicyConfig struct {
+	// Window is the period in which failures are counted
+	Window time.Duration
+
+	// MaxIPFailures rejects remote addresses after this many failures, 0 disables
+	MaxIPFailures int
+
+	// MaxUserFailures rejects logins after this many failures, 0 disables
+	MaxUserFailures int
+
+	// Delay is the delay imposed for each counted failure
+	Delay time.Duration
+}
+
+// policyRequest holds the default auth_policy_request_attributes
+type policyRequest struct {
+	Login        string     `json:"login"`
+	Remote       netip.Addr `json:"remote"`
+	Success      bool       `json:"success"`
+	PolicyReject bool       `json:"policy_reject"`
+}
+
+// remoteKey returns the failure key of the remote address, IPv4-mapped
+// addresses are counted as IPv4 ones
+func (r *policyRequest) remoteKey() string {
+	return "ip:" + r.Remote.Unmap().String()
+}
+
+// successKey returns the key of successful logins of the user from the
+// remote address
+func (r *policyRequest) successKey() string {
+	return r.Login + "\x00" + r.Remote.Unmap().String()
+}
+
+type policyResponse struct {
+	Status int    `json:"status"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+// policy holds authentication failures and successful logins within a
+// window, in memory of the process only
+type policy struct {
+	config PolicyConfig
+
+	lock      sync.Mutex
+	failures  map[string][]time.Time
+	successes map[string]time.Time
+	expired   time.Time
+}
+
+func newPolicy(config PolicyConfig) *policy {
+	return &policy{
+		config:    config,
+		failures:  make(map[string][]time.Time),
+		successes: make(map[string]time.Time),
+	}
+}
+
+// authPolicy implements Dovecot's auth policy server protocol
+func (d *Director) authPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		log.Print(err)
+
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	var request policyRequest
+	if err = json.Unmarshal(body, &request); err != nil {
+		log.Printf("Failed parsing policy request: %+v", err)
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var response policyResponse
+
+	switch command := r.URL.Query().Get("command"); command {
+	case "allow":
+		response = d.policy.allow(&request, time.Now())
+	case "report":
+		d.policy.report(&request, time.Now())
+	default:
+		log.Printf("Unknown policy command: %q", command)
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	sendResponse(w, &response)
+}
+
+// allow decides on a login attempt before authentication
+func (p *policy) allow(request *policyRequest, now time.Time) policyResponse {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	failures := 0
+
+	if p.config.MaxIPFailures > 0 && request.Remote.IsValid() {
+		n := p.countFailures(request.remoteKey(), now)
+		if n >= p.config.MaxIPFailures {
+			return policyResponse{Status: -1, Msg: "Too many failed logins from your address"}
+		}
+
+		failures = n
+	}
+
+	// a user logging in from an address with a recent successful login is
+	// not throttled for failures of others
+	if p.config.MaxUserFailures > 0 && request.Login != "" && !p.knownAddress(request, now) {
+		n := p.countFailures("user:"+request.Login, now)
+		if n >= p.config.MaxUserFailures {
+			return policyResponse{Status: -1, Msg: "Too many failed logins"}
+		}
+
+		failures = max(failures, n)
+	}
+
+	return policyResponse{Status: int(time.Duration(failures) * p.config.Delay / time.Second)}
+}
+
+// report records the result of an authentication
+func (p *policy) report(request *policyRequest, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expire(now)
+
+	if request.Success {
+		if request.Login != "" {
+			delete(p.failures, "user:"+request.Login)
+			p.successes[request.successKey()] = now
+		}
+
+		return
+	}
+
+	// attempts rejected by the policy itself are already counted
+	if request.PolicyReject {
+		return
+	}
+
+	if p.config.MaxIPFailures > 0 && request.Remote.IsValid() {
+		p.addFailure(request.remoteKey(), p.config.MaxIPFailures, now)
+	}
+	if p.config.MaxUserFailures > 0 && request.Login != "" {
+		p.addFailure("user:"+request.Login, p.config.MaxUserFailures, now)
+	}
+}
+
+func (p *policy) knownAddress(request *policyRequest, now time.Time) bool {
+	ts, ok := p.successes[request.successKey()]
+
+	return ok && now.Sub(ts) < p.config.Window
+}
+
+// countFailures returns the number of failures within the window
+func (p *policy) countFailures(key string, now time.Time) int {
+	failures := p.failures[key]
+	for len(failures) > 0 && now.Sub(failures[0]) >= p.config.Window {
+		failures = failures[1:]
+	}
+
+	if len(failures) == 0 {
+		delete(p.failures, key)
+	} else {
+		p.failures[key] = failures
+	}
+
+	return len(failures)
+}
+
+// addFailure records a failure, keeping at most limit entries for a key
+func (p *policy) addFailure(key string, limit int, now time.Time) {
+	failures := append(p.failures[key], now)
+	if len(failures) > limit {
+		failures = failures[len(failures)-limit:]
+	}
+
+	p.failures[key] = failures
+}
+
+// expire drops entries outside of the window, at most once a minute
+func (p *policy) expire(now time.Time) {
+	if now.Sub(p.expired) < time.Minute {
+		return
+	}
+	p.expired = now
+
+	for key := range p.failures {
+		p.countFailures(key, now)
+	}
+
+	for key, ts := range p.successes {
+		if now.Sub(ts) >= p.config.Window {
+			delete(p.successes, key)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	config := PolicyConfig{
+		Window:          time.Minute,
+		MaxIPFailures:   3,
+		MaxUserFailures: 2,
+		Delay:           time.Second,
+	}
+
+	remote := netip.MustParseAddr("192.0.2.1")
+	other := netip.MustParseAddr("192.0.2.2")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		request policyRequest
+		report  bool
+		after   time.Duration
+		status  int
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "delay grows with failures",
+			steps: []step{
+				{request: policyRequest{Login: "user", Remote: remote}, status: 0},
+				{request: policyRequest{Login: "user", Remote: remote}, report: true},
+				{request: policyRequest{Login: "user", Remote: remote}, status: 1},
+			},
+		},
+		{
+			name: "user rejected after failures",
+			steps: []step{
+				{request: policyRequest{Login: "user", Remote: remote}, report: true},
+				{request: policyRequest{Login: "user", Remote: other}, report: true},
+				{request: policyRequest{Login: "user", Remote: netip.MustParseAddr("192.0.2.3")}, status: -1},
+			},
+		},
+		{
+			name: "address rejected after failures",
+			steps: []step{
+				{request: policyRequest{Login: "a", Remote: remote}, report: true},
+				{request: policyRequest{Login: "b", Remote: remote}, report: true},
+				{request: policyRequest{Login: "c", Remote: remote}, report: true},
+				{request: policyRequest{Login: "d", Remote: remote}, status: -1},
+			},
+		},
+		{
+			name: "ipv4-mapped addresses counted as ipv4",
+			steps: []step{
+				{request: policyRequest{Login: "a", Remote: remote}, report: true},
+				{request: policyRequest{Login: "b", Remote: netip.MustParseAddr("::ffff:192.0.2.1")}, report: true},
+				{request: policyRequest{Login: "c", Remote: remote}, report: true},
+				{request: policyRequest{Login: "d", Remote: remote}, status: -1},
+			},
+		},
+		{
+			name: "failures expire",
+			steps: []step{
+				{request: policyRequest{Login: "user", Remote: remote}, report: true},
+				{request: policyRequest{Login: "user", Remote: other}, report: true},
+				{request: policyRequest{Login: "user", Remote: remote}, after: time.Minute, status: 0},
+			},
+		},
+		{
+			name: "success clears user failures",
+			steps: []step{
+				{request: policyRequest{Login: "user", Remote: remote}, report: true},
+				{request: policyRequest{Login: "user", Remote: remote, Success: true}, report: true},
+				{request: policyRequest{Login: "user", Remote: other}, status: 0},
+			},
+		},
+		{
+			name: "known address not throttled for user failures",
+			steps: []step{
+				{request: policyRequest{Login: "user", Remote: remote, Success: true}, report: true},
+				{request: policyRequest{Login: "user", Remote: other}, report: true},
+				{request: policyRequest{Login: "user", Remote: netip.MustParseAddr("192.0.2.3")}, report: true},
+				{request: policyRequest{Login: "user", Remote: remote}, status: 0},
+			},
+		},
+		{
+			name: "policy rejections not counted",
+			steps: []step{
+				{request: policyRequest{Login: "user", Remote: remote, PolicyReject: true}, report: true},
+				{request: policyRequest{Login: "user", Remote: remote}, status: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPolicy(config)
+			ts := now
+
+			for i, s := range tt.steps {
+				ts = ts.Add(s.after)
+
+				if s.report {
+					p.report(&s.request, ts)
+
+					continue
+				}
+
+				if response := p.allow(&s.request, ts); response.Status != s.status {
+					t.Errorf("step %d: status = %d, want %d", i, response.Status, s.status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/overrides"
+)
+
+const maxNetstringLength = 1 << 16
+
+var errInvalidNetstring = errors.New("invalid netstring")
+
+// ServeSocketmap serves Postfix socketmap transport lookups on l
+func (d *Director) ServeSocketmap(ctx context.Context, l net.Listener) error {
+	return serveConns(ctx, l, d.handleSocketmap)
+}
+
+// ServeTCPTable serves Postfix tcp_table transport lookups on l
+func (d *Director) ServeTCPTable(ctx context.Context, l net.Listener) error {
+	return serveConns(ctx, l, d.handleTCPTable)
+}
+
+// postfixTransport returns the LMTP transport for a recipient, or an empty
+// string for unknown and disabled recipients
+func (d *Director) postfixTransport(ctx context.Context, recipient string) (string, error) {
+	// domain lookups are not routed
+	if at := strings.LastIndexByte(recipient, '@'); at <= 0 {
+		return "", nil
+	}
+
+	authRequest := &dovecot.Request{Service: "lmtp"}
+	authRequest.SetUser(recipient)
+
+	attrs, err := d.lookup(ctx, overrides.DatabaseUserdb, authRequest)
+
+	// unknown, disabled and invalid recipients are not found
+	if userUnknown(err) {
+		return "", nil
+	}
+
+	if err != nil || attrs.Host == "" {
+		return "", err
+	}
+
+	port := d.lmtpPort
+	if attrs.Port != 0 {
+		port = attrs.Port
+	}
+
+	return fmt.Sprintf("lmtp:[%s]:%d", attrs.Host, port), nil
+}
+
+func (d *Director) handleSocketmap(ctx context.Context, conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	for {
+		request, err := readNetstring(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Print(err)
+			}
+
+			return
+		}
+
+		var reply string
+
+		// request is "<name> <key>"
+		if _, key, found := strings.Cut(request, " "); !found {
+			reply = "PERM invalid request"
+		} else if transport, err := d.postfixTransport(ctx, key); err != nil {
+			reply = "TEMP " + err.Error()
+		} else if transport == "" {
+			reply = "NOTFOUND "
+		} else {
+			reply = "OK " + transport
+		}
+
+		if _, err = fmt.Fprintf(conn, "%d:%s,", len(reply), reply); err != nil {
+			log.Print(err)
+
+			return
+		}
+	}
+}
+
+// readNetstring reads a netstring as in https://cr.yp.to/proto/netstrings.txt
+func readNetstring(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(':')
+	if err != nil {
+		return "", err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSuffix(prefix, ":"))
+	if err != nil || length < 0 || length > maxNetstringLength {
+		return "", errInvalidNetstring
+	}
+
+	data := make([]byte, length+1)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+
+	if data[length] != ',' {
+		return "", errInvalidNetstring
+	}
+
+	return string(data[:length]), nil
+}
+
+func (d *Director) handleTCPTable(ctx context.Context, conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+
+	for scanner.Scan() {
+		var reply string
+
+		cmd, arg, _ := strings.Cut(strings.TrimSuffix(scanner.Text(), "\r"), " ")
+		if cmd != "get" {
+			reply = "500 unsupported request"
+		} else if key, err := url.PathUnescape(arg); err != nil {
+			reply = "500 invalid key"
+		} else if transport, err := d.postfixTransport(ctx, key); err != nil {
+			reply = "400 " + tcpTableEscape(err.Error())
+		} else if transport == "" {
+			reply = "500 not found"
+		} else {
+			reply = "200 " + tcpTableEscape(transport)
+		}
+
+		if _, err := io.WriteString(conn, reply+"\n"); err != nil {
+			log.Print(err)
+
+			return
+		}
+	}
+}
+
+// tcpTableEscape escapes whitespace, control characters and '%' as %XX
+func tcpTableEscape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c >= 0x7f || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
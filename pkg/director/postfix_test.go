@@ -0,0 +1,149 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// postfixExchange sends request on a connection served by handle, and
+// returns the raw reply
+func postfixExchange(t *testing.T, handle func(context.Context, net.Conn), request string, reply func(*bufio.Reader) (string, error)) string {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go handle(ctx, server)
+
+	go io.WriteString(client, request)
+
+	response, err := reply(bufio.NewReader(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+// postfixMailboxes are the mailboxes of the postfix tests, checked for being
+// active
+var postfixMailboxes = staticMailboxes{
+	"user@example.com":     {Username: "user@example.com", Active: true, DomainActive: true},
+	"disabled@example.com": {Username: "disabled@example.com", DomainActive: true},
+}
+
+func TestSocketmap(t *testing.T) {
+	d := New(staticAllocator{"user@example.com": "10.0.0.1", "disabled@example.com": "10.0.0.1"},
+		WithLMTPPort(2424), WithMailboxes(postfixMailboxes), WithStatusCheck(true))
+
+	tests := []struct {
+		key   string
+		reply string
+	}{
+		{"transport user@example.com", "OK lmtp:[10.0.0.1]:2424"},
+		{"transport nobody@example.com", "NOTFOUND "},
+		{"transport disabled@example.com", "NOTFOUND "},
+		{"transport example.com", "NOTFOUND "},
+		{"invalid", "PERM invalid request"},
+	}
+
+	for _, tt := range tests {
+		reply := postfixExchange(t, d.handleSocketmap, fmt.Sprintf("%d:%s,", len(tt.key), tt.key), readNetstring)
+		if reply != tt.reply {
+			t.Errorf("%q: reply = %q, want %q", tt.key, reply, tt.reply)
+		}
+	}
+}
+
+func TestTCPTable(t *testing.T) {
+	d := New(staticAllocator{"user@example.com": "10.0.0.1", "disabled@example.com": "10.0.0.1"},
+		WithMailboxes(postfixMailboxes), WithStatusCheck(true))
+
+	tests := []struct {
+		request string
+		reply   string
+	}{
+		{"get user%40example.com", "200 lmtp:[10.0.0.1]:24"},
+		{"get user@example.com", "200 lmtp:[10.0.0.1]:24"},
+		{"get nobody@example.com", "500 not found"},
+		{"get disabled@example.com", "500 not found"},
+		{"get user%zz", "500 invalid key"},
+		{"put user@example.com", "500 unsupported request"},
+	}
+
+	for _, tt := range tests {
+		reply := postfixExchange(t, d.handleTCPTable, tt.request+"\n", func(r *bufio.Reader) (string, error) {
+			line, err := r.ReadString('\n')
+
+			return strings.TrimSuffix(line, "\n"), err
+		})
+		if reply != tt.reply {
+			t.Errorf("%q: reply = %q, want %q", tt.request, reply, tt.reply)
+		}
+	}
+}
+
+func TestReadNetstring(t *testing.T) {
+	tests := []struct {
+		input string
+		value string
+		err   bool
+	}{
+		{"5:hello,", "hello", false},
+		{"0:,", "", false},
+		{"5:hello;", "", true},
+		{"x:hello,", "", true},
+		{"-1:,", "", true},
+		{"5:hel", "", true},
+	}
+
+	for _, tt := range tests {
+		value, err := readNetstring(bufio.NewReader(strings.NewReader(tt.input)))
+		if (err != nil) != tt.err || value != tt.value {
+			t.Errorf("readNetstring(%q) = %q, %v", tt.input, value, err)
+		}
+	}
+}
+
+func TestTCPTableEscape(t *testing.T) {
+	if escaped := tcpTableEscape("a b%c\n"); escaped != "a%20b%25c%0A" {
+		t.Errorf("tcpTableEscape = %q", escaped)
+	}
+}
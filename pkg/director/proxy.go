@@ -0,0 +1,133 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// ProxyMode selects how a frontend is told to proxy to the backend
+type ProxyMode int
+
+const (
+	// ProxyAlways always proxies to the backend
+	ProxyAlways ProxyMode = iota
+
+	// ProxyMaybe returns proxy_maybe, letting Dovecot serve the user locally
+	// when it is the backend itself
+	ProxyMaybe
+
+	// ProxyLocal omits the proxy attributes when the request was received on
+	// the backend's address
+	ProxyLocal
+)
+
+// ParseProxyMode parses always, maybe or local into a ProxyMode
+func ParseProxyMode(mode string) (ProxyMode, error) {
+	switch mode {
+	case "always":
+		return ProxyAlways, nil
+	case "maybe":
+		return ProxyMaybe, nil
+	case "local":
+		return ProxyLocal, nil
+	}
+
+	return ProxyAlways, fmt.Errorf("invalid proxy mode: %q", mode)
+}
+
+// proxyAttributes returns the attributes directing a request to its routed
+// backend, authenticated tells whether the director checked its password
+func (d *Director) proxyAttributes(ctx context.Context, authRequest *dovecot.Request, r *route, authenticated bool) *dovecot.ResponseAttributes {
+	backend := r.backend
+
+	if d.referral.matches(authRequest) {
+		attrs := d.referral.referralAttributes(backend)
+		attrs.Version = d.version
+
+		return attrs
+	}
+
+	attrs := &dovecot.ResponseAttributes{
+		Version:    d.version,
+		Nopassword: authenticated,
+	}
+
+	// users served locally are authenticated by a passdb, only proxies
+	// leave it to the backend, unless the director checked the password
+	switch d.proxyMode {
+	case ProxyMaybe:
+		attrs.ProxyMaybe = true
+	case ProxyLocal:
+		if sameAddress(authRequest.Lip, backend) || sameAddress(authRequest.RealLip, backend) {
+			return attrs
+		}
+
+		attrs.Proxy = true
+		attrs.Nopassword = true
+	default:
+		attrs.Proxy = true
+		attrs.Nopassword = true
+	}
+
+	// service attributes take precedence over backend ones
+	attrs.Host = backend
+	attrs.ProxyAttributes = d.proxyDefaults.Merge(d.proxyBackends[backend]).Merge(d.services[authRequest.Service].Attributes)
+
+	// configured ports take precedence over discovered ones
+	if attrs.Port == 0 {
+		attrs.Port = d.servicePort(ctx, authRequest.Service, backend, attrs.SSL != "")
+	}
+
+	// the backend is logged in to as the target mailbox
+	if attrs.Destuser == "" && (r.target != authRequest.User || r.user != "") {
+		attrs.Destuser = r.target
+	}
+
+	return attrs
+}
+
+// sameAddress tells whether a is the address of backend
+func sameAddress(a netip.Addr, backend string) bool {
+	if !a.IsValid() {
+		return false
+	}
+
+	b, err := netip.ParseAddr(backend)
+	if err != nil {
+		return false
+	}
+
+	return a.Unmap() == b.Unmap()
+}
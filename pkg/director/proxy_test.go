@@ -0,0 +1,169 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestProxyAttributes(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          ProxyMode
+		authenticated bool
+		lip           string
+		proxy         bool
+		proxyMaybe    bool
+		nopassword    bool
+		host          string
+	}{
+		{
+			name:       "always",
+			mode:       ProxyAlways,
+			proxy:      true,
+			nopassword: true,
+			host:       "10.0.0.1",
+		},
+		{
+			name:       "maybe",
+			mode:       ProxyMaybe,
+			proxyMaybe: true,
+			host:       "10.0.0.1",
+		},
+		{
+			name:          "maybe authenticated",
+			mode:          ProxyMaybe,
+			authenticated: true,
+			proxyMaybe:    true,
+			nopassword:    true,
+			host:          "10.0.0.1",
+		},
+		{
+			name:       "local on another host",
+			mode:       ProxyLocal,
+			lip:        "10.0.0.2",
+			proxy:      true,
+			nopassword: true,
+			host:       "10.0.0.1",
+		},
+		{
+			name: "local on the backend",
+			mode: ProxyLocal,
+			lip:  "10.0.0.1",
+		},
+		{
+			name: "local on the mapped backend",
+			mode: ProxyLocal,
+			lip:  "::ffff:10.0.0.1",
+		},
+		{
+			name:          "local authenticated",
+			mode:          ProxyLocal,
+			authenticated: true,
+			lip:           "10.0.0.1",
+			nopassword:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(staticAllocator{}, WithProxyMode(tt.mode))
+
+			authRequest := &dovecot.Request{User: "user@example.com", Service: "imap"}
+			if tt.lip != "" {
+				authRequest.Lip = netip.MustParseAddr(tt.lip)
+			}
+
+			attrs := d.proxyAttributes(context.Background(), authRequest, &route{key: "user@example.com", target: "user@example.com", backend: "10.0.0.1"}, tt.authenticated)
+
+			if attrs.Proxy != tt.proxy || attrs.ProxyMaybe != tt.proxyMaybe || attrs.Nopassword != tt.nopassword || attrs.Host != tt.host {
+				t.Errorf("got proxy=%v proxy_maybe=%v nopassword=%v host=%q", attrs.Proxy, attrs.ProxyMaybe, attrs.Nopassword, attrs.Host)
+			}
+		})
+	}
+}
+
+func TestParseProxyMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want ProxyMode
+		err  bool
+	}{
+		{mode: "always", want: ProxyAlways},
+		{mode: "maybe", want: ProxyMaybe},
+		{mode: "local", want: ProxyLocal},
+		{mode: "never", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseProxyMode(tt.mode)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("got %v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestDestuser(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  string
+		route route
+		proxy dovecot.ProxyAttributes
+		want  string
+	}{
+		{name: "user", user: "a@example.com", route: route{key: "a@example.com", target: "a@example.com"}},
+		{name: "routing key", user: "a@example.com", route: route{key: "a", target: "a@example.com"}},
+		{name: "resolved", user: "a@example.com", route: route{user: "a@example.com", key: "a@example.com", target: "a@example.com"}, want: "a@example.com"},
+		{name: "master passdb", user: "master@example.org", route: route{key: "a@example.com", target: "a@example.com"}, want: "a@example.com"},
+		{name: "configured", user: "master@example.org", route: route{key: "a@example.com", target: "a@example.com"}, proxy: dovecot.ProxyAttributes{Destuser: "b"}, want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(staticAllocator{}, WithProxyAttributes(tt.proxy, nil))
+
+			authRequest := &dovecot.Request{}
+			authRequest.SetUser(tt.user)
+
+			r := tt.route
+			r.backend = "10.0.0.1"
+
+			if attrs := d.proxyAttributes(context.Background(), authRequest, &r, false); attrs.Destuser != tt.want {
+				t.Errorf("got destuser %q, want %q", attrs.Destuser, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"net/netip"
+	"slices"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// defaultReferralServices receive referrals when only networks are set, as
+// LOGIN-REFERRAL is an IMAP response
+var defaultReferralServices = []string{"imap"}
+
+// ReferralConfig selects clients which are referred to their backend's host
+// with a login referral instead of being proxied
+type ReferralConfig struct {
+	// Services receiving referrals, imap if empty
+	Services []string
+
+	// Networks of clients able to follow referrals, empty matches all clients
+	Networks []netip.Prefix
+
+	// Hosts maps backends to the host names clients are referred to,
+	// unlisted backends are referred to directly
+	Hosts map[string]string
+}
+
+func (c *ReferralConfig) enabled() bool {
+	return len(c.Services) > 0 || len(c.Networks) > 0
+}
+
+// matches tells whether the client of a request is to be referred
+func (c *ReferralConfig) matches(authRequest *dovecot.Request) bool {
+	if !c.enabled() {
+		return false
+	}
+
+	services := c.Services
+	if len(services) == 0 {
+		services = defaultReferralServices
+	}
+
+	if !slices.Contains(services, authRequest.Service) {
+		return false
+	}
+
+	if len(c.Networks) > 0 {
+		rip := authRequest.Rip
+		if !rip.IsValid() {
+			return false
+		}
+
+		return slices.ContainsFunc(c.Networks, func(network netip.Prefix) bool {
+			return network.Contains(rip.Unmap())
+		})
+	}
+
+	return true
+}
+
+// referralAttributes returns a login referral to backend
+func (c *ReferralConfig) referralAttributes(backend string) *dovecot.ResponseAttributes {
+	host := backend
+	if h, ok := c.Hosts[backend]; ok {
+		host = h
+	}
+
+	return &dovecot.ResponseAttributes{
+		Nopassword: true,
+		Nologin:    true,
+		Reason:     "Your account is served by another server",
+		Host:       host,
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"net/netip"
+	"testing"
+
+	"go-dovecot-director/pkg/dovecot"
+)
+
+func TestReferralMatches(t *testing.T) {
+	network := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+
+	tests := []struct {
+		name    string
+		config  ReferralConfig
+		service string
+		rip     string
+		want    bool
+	}{
+		{
+			name:    "disabled",
+			service: "imap",
+			rip:     "192.0.2.1",
+		},
+		{
+			name:    "listed service",
+			config:  ReferralConfig{Services: []string{"imap", "pop3"}},
+			service: "pop3",
+			want:    true,
+		},
+		{
+			name:    "unlisted service",
+			config:  ReferralConfig{Services: []string{"imap"}},
+			service: "pop3",
+		},
+		{
+			name:    "network defaults to imap",
+			config:  ReferralConfig{Networks: network},
+			service: "imap",
+			rip:     "192.0.2.1",
+			want:    true,
+		},
+		{
+			name:    "network of other services",
+			config:  ReferralConfig{Networks: network},
+			service: "submission",
+			rip:     "192.0.2.1",
+		},
+		{
+			name:    "network and listed service",
+			config:  ReferralConfig{Services: []string{"pop3"}, Networks: network},
+			service: "pop3",
+			rip:     "::ffff:192.0.2.1",
+			want:    true,
+		},
+		{
+			name:    "outside network",
+			config:  ReferralConfig{Networks: network},
+			service: "imap",
+			rip:     "198.51.100.1",
+		},
+		{
+			name:    "network without rip",
+			config:  ReferralConfig{Networks: network},
+			service: "imap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authRequest := &dovecot.Request{Service: tt.service}
+			if tt.rip != "" {
+				authRequest.Rip = netip.MustParseAddr(tt.rip)
+			}
+
+			if got := tt.config.matches(authRequest); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferralAttributes(t *testing.T) {
+	config := ReferralConfig{Hosts: map[string]string{"10.0.0.1": "imap1.example.com"}}
+
+	for backend, host := range map[string]string{
+		"10.0.0.1": "imap1.example.com",
+		"10.0.0.2": "10.0.0.2",
+	} {
+		attrs := config.referralAttributes(backend)
+		if !attrs.Nologin || attrs.Proxy || attrs.Host != host {
+			t.Errorf("%s: got nologin=%v proxy=%v host=%q", backend, attrs.Nologin, attrs.Proxy, attrs.Host)
+		}
+	}
+}
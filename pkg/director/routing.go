@@ -0,0 +1,150 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/mailbox"
+)
+
+// route is a request routed to a backend
+type route struct {
+	// user is the canonical user name if it differs from the requested one
+	user string
+
+	// key is the name the backend is allocated for
+	key string
+
+	// target is the mailbox logged in to
+	target string
+
+	backend string
+
+	// mailbox is set if it was read while checking the account
+	mailbox *mailbox.Mailbox
+}
+
+// route normalizes, validates and resolves a request, checks its account,
+// verifying the password if asked for, and allocates a backend for its
+// routing key
+func (d *Director) route(ctx context.Context, authRequest *dovecot.Request, verifyPassword bool) (*route, error) {
+	requested := authRequest.User
+	if err := d.normalization.Normalize(authRequest); err != nil {
+		return nil, err
+	}
+
+	if err := authRequest.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := d.resolve(ctx, authRequest); err != nil {
+		return nil, err
+	}
+
+	r := &route{key: d.routingKey(authRequest), target: target(authRequest).User}
+	if authRequest.User != requested {
+		r.user = authRequest.User
+	}
+
+	if r.key == "" {
+		return nil, &dovecot.RequestError{Field: "routing key", Reason: "empty"}
+	}
+
+	if !d.chain.Owns(authRequest.Domain) {
+		return nil, errNotOwned
+	}
+
+	var err error
+	if r.mailbox, err = d.checkAccount(ctx, authRequest, r.target, verifyPassword); err != nil {
+		return nil, err
+	}
+
+	if r.backend, err = d.allocate(ctx, authRequest, r.key); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// resolve replaces the user names of a request with the mailboxes they
+// resolve to
+func (d *Director) resolve(ctx context.Context, authRequest *dovecot.Request) error {
+	if d.resolver == nil {
+		return nil
+	}
+
+	user, err := d.resolver.Resolve(ctx, authRequest.User)
+	if err != nil {
+		return err
+	}
+
+	if user != authRequest.User {
+		authRequest.SetUser(user)
+	}
+
+	if authRequest.LoginUser == "" {
+		return nil
+	}
+
+	if authRequest.LoginUser, err = d.resolver.Resolve(ctx, authRequest.LoginUser); err != nil {
+		return err
+	}
+	authRequest.LoginUsername, authRequest.LoginDomain = dovecot.SplitUser(authRequest.LoginUser)
+
+	return nil
+}
+
+// target returns a request with the user fields of the target mailbox.
+// While the master passdb is queried for a master user login, the target is
+// in the login user fields.
+func target(authRequest *dovecot.Request) *dovecot.Request {
+	if authRequest.LoginUser == "" {
+		return authRequest
+	}
+
+	t := *authRequest
+	t.SetUser(authRequest.LoginUser)
+
+	return &t
+}
+
+// routingKey returns the name the backend of a request is allocated for,
+// master user logins are routed on the target mailbox
+func (d *Director) routingKey(authRequest *dovecot.Request) string {
+	authRequest = target(authRequest)
+
+	if d.routingTemplate == nil {
+		return authRequest.User
+	}
+
+	return d.routingTemplate.Expand(authRequest)
+}
@@ -0,0 +1,223 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// staticResolver resolves the addresses it holds, others to themselves
+type staticResolver map[string]string
+
+var errResolve = errors.New("resolve failed")
+
+func (r staticResolver) Resolve(ctx context.Context, address string) (string, error) {
+	if address == "broken@example.com" {
+		return "", errResolve
+	}
+
+	if mailbox, ok := r[address]; ok {
+		return mailbox, nil
+	}
+
+	return address, nil
+}
+
+func TestRouteResolve(t *testing.T) {
+	resolver := staticResolver{
+		"a@alias.example":      "a@example.com",
+		"info@example.com":     "a@example.com",
+		"master@alias.example": "master@example.com",
+	}
+	users := staticAllocator{
+		"a@example.com":      "10.0.0.1",
+		"master@example.com": "10.0.0.2",
+	}
+
+	tests := []struct {
+		name    string
+		request dovecot.Request
+		user    string
+		key     string
+		backend string
+		err     error
+	}{
+		{name: "mailbox", request: dovecot.Request{User: "a@example.com"}, key: "a@example.com", backend: "10.0.0.1"},
+		{name: "alias domain", request: dovecot.Request{User: "a@alias.example"}, user: "a@example.com", key: "a@example.com", backend: "10.0.0.1"},
+		{name: "alias", request: dovecot.Request{User: "info@example.com"}, user: "a@example.com", key: "a@example.com", backend: "10.0.0.1"},
+		{name: "unresolved", request: dovecot.Request{User: "b@example.com"}, err: allocator.ErrUserUnknown},
+		{name: "resolver error", request: dovecot.Request{User: "broken@example.com"}, err: errResolve},
+		{
+			name:    "login user",
+			request: dovecot.Request{User: "master@alias.example", LoginUser: "info@example.com"},
+			user:    "master@example.com",
+			key:     "a@example.com",
+			backend: "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(users, WithResolver(resolver))
+
+			request := tt.request
+			request.SetUser(request.User)
+
+			r, err := d.route(context.Background(), &request, false)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+
+			if r.user != tt.user || r.key != tt.key || r.backend != tt.backend {
+				t.Errorf("got user %q, key %q, backend %q", r.user, r.key, r.backend)
+			}
+			if tt.user != "" && (request.User != tt.user || request.Username+"@"+request.Domain != tt.user) {
+				t.Errorf("request user %q (%q, %q) not replaced", request.User, request.Username, request.Domain)
+			}
+		})
+	}
+}
+
+func TestRoutingKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		request  dovecot.Request
+		want     string
+	}{
+		{name: "user", request: dovecot.Request{User: "a@example.com"}, want: "a@example.com"},
+		{name: "username", template: "%{username}", request: dovecot.Request{User: "a@example.com"}, want: "a"},
+		{name: "master passdb", request: dovecot.Request{User: "master@example.org", LoginUser: "a@example.com"}, want: "a@example.com"},
+		{name: "master passdb username", template: "%{username}", request: dovecot.Request{User: "master@example.org", LoginUser: "a@example.com"}, want: "a"},
+		{name: "master passdb domain", template: "%{domain}", request: dovecot.Request{User: "master@example.org", LoginUser: "a@example.com"}, want: "example.com"},
+		{name: "master user", request: dovecot.Request{User: "a@example.com", MasterUser: "master@example.org"}, want: "a@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var options []Option
+			if tt.template != "" {
+				template, err := dovecot.ParseTemplate(tt.template)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				options = append(options, WithRoutingKey(template))
+			}
+
+			d := New(staticAllocator{}, options...)
+
+			request := tt.request
+			request.SetUser(request.User)
+
+			if got := d.routingKey(&request); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTarget(t *testing.T) {
+	template, err := dovecot.ParseTemplate("%{username}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailboxes := staticMailboxes{
+		"a@example.com":      {Username: "a@example.com", Password: "{PLAIN}secret", Maildir: "example.com/a/", Active: true, DomainActive: true},
+		"master@example.org": {Username: "master@example.org", Password: "{PLAIN}master", Active: true, DomainActive: true},
+	}
+	d := New(staticAllocator{"a": "10.0.0.1"},
+		WithRoutingKey(template),
+		WithMailboxes(mailboxes),
+		WithStatusCheck(true),
+		WithPasswordVerification(true),
+		WithUserdb(UserdbTemplates{Home: "/var/vmail/%{maildir}"}, nil),
+	)
+
+	tests := []struct {
+		name    string
+		request dovecot.Request
+		err     error
+	}{
+		{name: "user", request: dovecot.Request{User: "a@example.com", Password: "secret"}},
+		{name: "password mismatch", request: dovecot.Request{User: "a@example.com", Password: "master"}, err: errPasswordMismatch},
+		{name: "master passdb", request: dovecot.Request{User: "master@example.org", LoginUser: "a@example.com", Password: "master"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+			request.SetUser(request.User)
+
+			r, err := d.route(context.Background(), &request, true)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+
+			if r.key != "a" || r.target != "a@example.com" || r.backend != "10.0.0.1" {
+				t.Errorf("got key %q, target %q, backend %q", r.key, r.target, r.backend)
+			}
+		})
+	}
+
+	t.Run("userdb", func(t *testing.T) {
+		request := dovecot.Request{}
+		request.SetUser("a@example.com")
+
+		attrs, err := d.userdbLookup(context.Background(), &request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if attrs.Home != "/var/vmail/example.com/a/" {
+			t.Errorf("got home %q", attrs.Home)
+		}
+	})
+}
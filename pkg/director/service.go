@@ -0,0 +1,109 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/pool"
+)
+
+// errServiceUnavailable is returned when the allocated backend does not
+// serve the service, allocating again would return the same backend
+var errServiceUnavailable = errors.New("backend does not serve the service")
+
+// ServiceConfig configures routing of a Dovecot service, like imap or lmtp
+type ServiceConfig struct {
+	// Attributes override the proxy attributes of backends for the service
+	Attributes dovecot.ProxyAttributes
+
+	// Pool optionally monitors the backends serving the service. Backends are
+	// still allocated by the allocator to keep users on the same backend for
+	// all services, the pool only tells whether the backend serves the
+	// service, so it must hold addresses of the main pool.
+	Pool pool.Pool
+}
+
+// checkService returns an error if backend does not serve service
+func (d *Director) checkService(ctx context.Context, service, backend string) error {
+	p := d.services[service].Pool
+	if p == nil || backend == "" {
+		return nil
+	}
+
+	alive, err := p.IsBackendAlive(ctx, backend)
+	if err != nil {
+		return err
+	}
+
+	if !alive {
+		return fmt.Errorf("%w: %s for %s", errServiceUnavailable, backend, service)
+	}
+
+	return nil
+}
+
+// servicePort returns the port of service discovered on backend, or 0. The
+// pool of the service is asked first, and implicit TLS ports are named with
+// an s suffix, like imaps.
+func (d *Director) servicePort(ctx context.Context, service, backend string, ssl bool) int {
+	if service == "" {
+		return 0
+	}
+
+	name := service
+	if ssl {
+		name += "s"
+	}
+
+	for _, p := range []pool.Pool{d.services[service].Pool, d.pool} {
+		ports, ok := p.(pool.Ports)
+		if !ok {
+			continue
+		}
+
+		port, err := ports.BackendPort(ctx, backend, name)
+		if err != nil {
+			log.Print(err)
+
+			continue
+		}
+
+		if port != 0 {
+			return port
+		}
+	}
+
+	return 0
+}
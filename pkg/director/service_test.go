@@ -0,0 +1,108 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+)
+
+// staticPool serves the listed backends on the named ports
+type staticPool map[string]map[string]int
+
+func (p staticPool) Run(context.Context) {}
+
+func (p staticPool) GetBackend(context.Context) (string, error) {
+	return "", allocator.ErrNoBackends
+}
+
+func (p staticPool) IsBackendAlive(ctx context.Context, backend string) (bool, error) {
+	_, ok := p[backend]
+
+	return ok, nil
+}
+
+func (p staticPool) BackendPort(ctx context.Context, backend, name string) (int, error) {
+	return p[backend][name], nil
+}
+
+func TestService(t *testing.T) {
+	d := New(staticAllocator{"a@example.com": "10.0.0.1", "b@example.com": "10.0.0.2"},
+		WithPool(staticPool{"10.0.0.1": {"imap": 143, "pop3": 110}, "10.0.0.2": {"imap": 143}}),
+		WithService("imap", ServiceConfig{
+			Attributes: dovecot.ProxyAttributes{SSL: "yes"},
+			Pool:       staticPool{"10.0.0.1": {"imaps": 1993}},
+		}),
+		WithService("lmtp", ServiceConfig{Attributes: dovecot.ProxyAttributes{Port: 2424}}),
+	)
+
+	tests := []struct {
+		name    string
+		user    string
+		service string
+		port    int
+		ssl     string
+	}{
+		{name: "service pool port", user: "a@example.com", service: "imap", port: 1993, ssl: "yes"},
+		{name: "backend pool port", user: "a@example.com", service: "pop3", port: 110},
+		{name: "configured port", user: "a@example.com", service: "lmtp", port: 2424},
+		{name: "unconfigured service", user: "b@example.com", service: "smtp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs, err := d.lookup(context.Background(), "", &dovecot.Request{User: tt.user, Service: tt.service})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if attrs.Port != tt.port || attrs.SSL != tt.ssl {
+				t.Errorf("got port=%d ssl=%q", attrs.Port, attrs.SSL)
+			}
+		})
+	}
+
+	// backends not serving a service are not routed to, without retrying
+	start := time.Now()
+	if _, err := d.lookup(context.Background(), "", &dovecot.Request{User: "b@example.com", Service: "imap"}); !errors.Is(err, errServiceUnavailable) {
+		t.Errorf("err = %v, want service unavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("lookup took %v", elapsed)
+	}
+	if err := d.checkService(context.Background(), "pop3", "10.0.0.2"); err != nil {
+		t.Errorf("err = %v for service without pool", err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package director
+
+import (
+	"context"
+	"strings"
+
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/overrides"
+)
+
+// UserdbTemplates are the userdb fields returned for mailboxes. Home and
+// Mail may refer to %{user}, %{username}, %{domain}, %{maildir} and
+// %{backend}, like maildir:/var/vmail/%{maildir}.
+type UserdbTemplates struct {
+	UID  string
+	GID  string
+	Home string
+	Mail string
+}
+
+// merge returns t overridden by the set fields of o
+func (t UserdbTemplates) merge(o UserdbTemplates) UserdbTemplates {
+	if o.UID != "" {
+		t.UID = o.UID
+	}
+	if o.GID != "" {
+		t.GID = o.GID
+	}
+	if o.Home != "" {
+		t.Home = o.Home
+	}
+	if o.Mail != "" {
+		t.Mail = o.Mail
+	}
+
+	return t
+}
+
+// userLookup answers userdb lookups, with the fields of the mailbox if the
+// director is the userdb of the backends, and the proxy attributes otherwise
+func (d *Director) userLookup(ctx context.Context, authRequest *dovecot.Request) (*dovecot.ResponseAttributes, error) {
+	if d.userdb {
+		return d.userdbLookup(ctx, authRequest)
+	}
+
+	return d.lookup(ctx, overrides.DatabaseUserdb, authRequest)
+}
+
+// userdbLookup routes a request and returns the userdb fields of its target
+// mailbox
+func (d *Director) userdbLookup(ctx context.Context, authRequest *dovecot.Request) (*dovecot.ResponseAttributes, error) {
+	rt, err := d.route(ctx, authRequest, false)
+	if err != nil {
+		return nil, err
+	}
+
+	m := rt.mailbox
+	if m == nil {
+		if m, err = d.mailboxes.Get(ctx, rt.target); err != nil {
+			return nil, err
+		}
+	}
+
+	backend := rt.backend
+
+	username, domain := dovecot.SplitUser(m.Username)
+	if m.Domain != "" {
+		domain = m.Domain
+	}
+
+	r := strings.NewReplacer(
+		"%{user}", m.Username,
+		"%{username}", username,
+		"%{domain}", domain,
+		"%{maildir}", m.Maildir,
+		"%{backend}", backend,
+	)
+
+	t := d.userdbDefaults.merge(d.userdbBackends[backend])
+
+	attrs := &dovecot.ResponseAttributes{
+		UserdbAttributes: dovecot.UserdbAttributes{
+			UID:        t.UID,
+			GID:        t.GID,
+			Home:       r.Replace(t.Home),
+			Mail:       r.Replace(t.Mail),
+			QuotaBytes: m.Quota,
+		},
+		Version: d.version,
+		User:    rt.user,
+	}
+	if err = d.mergeOverrides(ctx, overrides.DatabaseUserdb, rt, attrs); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
@@ -29,8 +29,120 @@ SUCH DAMAGE.
 
 package dovecot
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+)
+
 type ResponseAttributes struct {
+	// User is the canonical user name, if it differs from the requested one
+	User string `json:"user,omitempty"`
+
 	Nopassword bool   `json:"nopassword,omitempty"`
 	Proxy      bool   `json:"proxy,omitempty"`
+	ProxyMaybe bool   `json:"proxy_maybe,omitempty"`
 	Host       string `json:"host,omitempty"`
+	Nologin    bool   `json:"nologin,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+
+	ProxyAttributes
+	UserdbAttributes
+
+	// Version selects the serialization of the attributes, defaults to 2.3
+	Version Version `json:"-"`
+}
+
+// MarshalJSON flattens Extra into the attributes, and formats durations, the
+// mail location and the quota for the Dovecot version
+func (a ResponseAttributes) MarshalJSON() ([]byte, error) {
+	type attributes ResponseAttributes
+
+	b, err := json.Marshal(attributes(a))
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := decodeValues(b)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(values, "extra")
+	for key, value := range values {
+		// booleans explicitly turned off are not sent
+		if value == false {
+			delete(values, key)
+		}
+	}
+	for key, d := range map[string]Duration{"proxy_timeout": a.ProxyTimeout, "proxy_refresh": a.ProxyRefresh} {
+		if d != 0 {
+			values[key] = a.Version.formatDuration(d)
+		}
+	}
+	if a.Mail != "" {
+		fields, err := a.Version.mailFields(a.Mail)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(values, fields)
+	}
+	if a.QuotaBytes > 0 {
+		maps.Copy(values, a.Version.quotaFields(a.QuotaBytes))
+	}
+	for key, value := range a.Extra {
+		values[key] = value
+	}
+
+	return json.Marshal(values)
+}
+
+// Fields returns the attributes as sorted key=value extra fields, as used
+// by the line based Dovecot protocols, without the user
+func (a *ResponseAttributes) Fields() ([]string, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := decodeValues(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// the line based protocols carry the user separately
+	delete(values, "user")
+
+	fields := make([]string, 0, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case bool:
+			if v {
+				fields = append(fields, key+"="+a.Version.formatBool())
+			}
+		case string:
+			fields = append(fields, key+"="+v)
+		default:
+			fields = append(fields, fmt.Sprintf("%s=%v", key, v))
+		}
+	}
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+// decodeValues decodes a json object, keeping numbers intact
+func decodeValues(b []byte) (map[string]any, error) {
+	var values map[string]any
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
 }
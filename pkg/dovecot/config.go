@@ -0,0 +1,122 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var configTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"lua": luaQuote,
+}).ParseFS(templates, "templates/*.tmpl"))
+
+// ScriptConfig holds the settings of the generated Lua script and Dovecot
+// configuration
+type ScriptConfig struct {
+	// URL is the base URL of the director
+	URL string
+
+	// Token is sent as a bearer token if set
+	Token string
+
+	// LuaFile is the path of the script in the Dovecot configuration
+	LuaFile string
+
+	Version Version
+}
+
+// Validate checks the settings for values breaking the generated files
+func (c ScriptConfig) Validate() error {
+	if !path.IsAbs(c.LuaFile) || strings.IndexFunc(c.LuaFile, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(`"'#{}\$%`, r)
+	}) >= 0 {
+		return fmt.Errorf("invalid lua file: %q", c.LuaFile)
+	}
+
+	return nil
+}
+
+// requestVariable is a request field and the auth variable it is read from
+type requestVariable struct {
+	Field    string
+	Variable string
+}
+
+// WriteLua writes the Lua script proxying passdb and userdb lookups to the
+// director
+func WriteLua(w io.Writer, c ScriptConfig) error {
+	return c.execute(w, "proxy.lua.tmpl")
+}
+
+// WriteConf writes the passdb and userdb configuration using the Lua script
+func WriteConf(w io.Writer, c ScriptConfig) error {
+	return c.execute(w, "dovecot.conf.tmpl")
+}
+
+func (c ScriptConfig) execute(w io.Writer, name string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	return configTemplates.ExecuteTemplate(w, name, struct {
+		ScriptConfig
+		Variables []requestVariable
+	}{c, c.Version.requestVariables()})
+}
+
+// luaQuote returns s as a Lua string literal
+func luaQuote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
@@ -0,0 +1,188 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLuaQuote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "", want: `""`},
+		{s: "http://director:8080", want: `"http://director:8080"`},
+		{s: `a"b\c`, want: `"a\"b\\c"`},
+		{s: "a\nb\x00\x7f", want: `"a\010b\000\127"`},
+		{s: "é", want: `"é"`},
+	}
+
+	for _, tt := range tests {
+		if got := luaQuote(tt.s); got != tt.want {
+			t.Errorf("luaQuote(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestScriptConfigValidate(t *testing.T) {
+	tests := []struct {
+		luaFile string
+		valid   bool
+	}{
+		{luaFile: "/etc/dovecot/proxy.lua", valid: true},
+		{luaFile: "/etc/dovecot/conf.d/director-proxy_2.lua", valid: true},
+		{luaFile: ""},
+		{luaFile: "proxy.lua"},
+		{luaFile: "/etc/dovecot/proxy.lua blocking=no"},
+		{luaFile: "/etc/dovecot/proxy.lua\n}\npassdb static {"},
+		{luaFile: "/etc/dovecot/proxy.lua\x00"},
+		{luaFile: "/etc/dovecot/proxy.lua "},
+		{luaFile: `/etc/dovecot/"proxy.lua"`},
+		{luaFile: "/etc/dovecot/proxy.lua#"},
+		{luaFile: "/etc/%{user}.lua"},
+	}
+
+	for _, tt := range tests {
+		err := ScriptConfig{LuaFile: tt.luaFile}.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: err = %v", tt.luaFile, err)
+		}
+	}
+}
+
+func TestWriteConf(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ScriptConfig
+		contains []string
+		err      bool
+	}{
+		{
+			name:     "2.3",
+			config:   ScriptConfig{LuaFile: "/etc/dovecot/proxy.lua", Version: Version23},
+			contains: []string{"driver = lua\n  args = file=/etc/dovecot/proxy.lua blocking=yes\n"},
+		},
+		{
+			name:     "2.4",
+			config:   ScriptConfig{LuaFile: "/etc/dovecot/proxy.lua", Version: Version24},
+			contains: []string{"passdb lua {\n  lua_file = /etc/dovecot/proxy.lua\n}", "userdb lua {\n  lua_file = /etc/dovecot/proxy.lua\n}"},
+		},
+		{
+			name:   "invalid lua file",
+			config: ScriptConfig{LuaFile: "/etc/dovecot/proxy.lua\n}\npassdb static {", Version: Version24},
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := WriteConf(&b, tt.config)
+			if tt.err {
+				if err == nil || b.Len() > 0 {
+					t.Errorf("err = %v, wrote %q", err, b.String())
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(b.String(), s) {
+					t.Errorf("missing %q in:\n%s", s, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteLua(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ScriptConfig
+		contains []string
+		excludes []string
+	}{
+		{
+			name:   "2.3",
+			config: ScriptConfig{URL: "http://director:8080", LuaFile: "/etc/dovecot/proxy.lua", Version: Version23},
+			contains: []string{
+				`local url = "http://director:8080"`,
+				`local token = ""`,
+				"timeout = 5000,",
+				`["rip"] = "rip",`,
+			},
+			excludes: []string{"connect_timeout"},
+		},
+		{
+			name:   "2.4",
+			config: ScriptConfig{URL: "http://director:8080", Token: `se"cret`, LuaFile: "/etc/dovecot/proxy.lua", Version: Version24},
+			contains: []string{
+				`local token = "se\"cret"`,
+				`connect_timeout = "5 sec",`,
+				`["rip"] = "remote_ip",`,
+			},
+			excludes: []string{"timeout = 5000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := WriteLua(&b, tt.config); err != nil {
+				t.Fatal(err)
+			}
+			script := b.String()
+
+			for _, s := range tt.contains {
+				if !strings.Contains(script, s) {
+					t.Errorf("missing %q", s)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(script, s) {
+					t.Errorf("unexpected %q", s)
+				}
+			}
+
+			// userdb results are checked against the userdb constants
+			_, userdb, _ := strings.Cut(script, "function auth_userdb_lookup")
+			userdb, _, _ = strings.Cut(userdb, "\nend\n")
+			if !strings.Contains(userdb, "dovecot.auth.USERDB_RESULT_OK") || strings.Contains(userdb, "PASSDB_RESULT") {
+				t.Errorf("userdb lookup not using userdb results:%s", userdb)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// PassdbAttributes are the passdb extra fields restricting logins, see
+// https://doc.dovecot.org/configuration_manual/authentication/password_database_extra_fields/
+type PassdbAttributes struct {
+	// AllowNets are the comma separated networks clients may log in from
+	AllowNets string `json:"allow_nets,omitempty"`
+
+	// AllowRealNets are the comma separated networks the connections to
+	// the proxy may come from
+	AllowRealNets string `json:"allow_real_nets,omitempty"`
+
+	// Nodelay skips the delay of failed logins
+	Nodelay *bool `json:"nodelay,omitempty"`
+}
+
+// Validate checks the networks for values Dovecot would not accept
+func (p *PassdbAttributes) Validate() error {
+	for name, nets := range map[string]string{"allow_nets": p.AllowNets, "allow_real_nets": p.AllowRealNets} {
+		if nets == "" {
+			continue
+		}
+
+		for network := range strings.SplitSeq(nets, ",") {
+			network = strings.TrimSpace(network)
+			if network == "local" {
+				continue
+			}
+
+			if _, err := netip.ParsePrefix(network); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(network); err != nil {
+				return fmt.Errorf("invalid %s network: %q", name, network)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Merge returns p overridden by the set fields of o
+func (p PassdbAttributes) Merge(o PassdbAttributes) PassdbAttributes {
+	if o.AllowNets != "" {
+		p.AllowNets = o.AllowNets
+	}
+	if o.AllowRealNets != "" {
+		p.AllowRealNets = o.AllowRealNets
+	}
+	if o.Nodelay != nil {
+		p.Nodelay = o.Nodelay
+	}
+
+	return p
+}
+
+// UserdbAttributes are the userdb extra fields of a mailbox, see
+// https://doc.dovecot.org/configuration_manual/authentication/user_database_extra_fields/
+type UserdbAttributes struct {
+	UID  string `json:"uid,omitempty"`
+	GID  string `json:"gid,omitempty"`
+	Home string `json:"home,omitempty"`
+
+	// Mail is the mail location, split into its parts for 2.4
+	Mail string `json:"-"`
+
+	// QuotaBytes is the storage quota, 0 is unlimited
+	QuotaBytes int64 `json:"-"`
+}
@@ -0,0 +1,146 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Port is a TCP port, read from json as a number or a string
+type Port uint16
+
+func (p *Port) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*p = 0
+
+		return nil
+	}
+
+	port, err := strconv.ParseUint(string(b), 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port: %q", b)
+	}
+
+	*p = Port(port)
+
+	return nil
+}
+
+func (p *Port) UnmarshalJSON(b []byte) error {
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*p = 0
+	case float64:
+		if v < 0 || v > 65535 || v != float64(int(v)) {
+			return fmt.Errorf("invalid port: %s", b)
+		}
+
+		*p = Port(v)
+	case string:
+		return p.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("invalid port: %s", b)
+	}
+
+	return nil
+}
+
+// Secured tells how the client connection is secured
+type Secured int
+
+const (
+	// SecuredNo is an insecure connection
+	SecuredNo Secured = iota
+
+	// SecuredLocal is considered secure without TLS, e.g. from localhost
+	SecuredLocal
+
+	// SecuredTLS is secured by TLS
+	SecuredTLS
+)
+
+func (s Secured) MarshalText() ([]byte, error) {
+	switch s {
+	case SecuredLocal:
+		return []byte("secured"), nil
+	case SecuredTLS:
+		return []byte("TLS"), nil
+	}
+
+	return []byte{}, nil
+}
+
+// UnmarshalText accepts Dovecot's empty, secured and TLS values, and
+// boolean like values of older versions
+func (s *Secured) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "", "no", "n", "0", "false":
+		*s = SecuredNo
+	case "secured", "yes", "y", "1", "true":
+		*s = SecuredLocal
+	case "tls":
+		*s = SecuredTLS
+	default:
+		return fmt.Errorf("invalid secured value: %q", b)
+	}
+
+	return nil
+}
+
+func (s *Secured) UnmarshalJSON(b []byte) error {
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*s = SecuredNo
+	case bool:
+		*s = SecuredNo
+		if v {
+			*s = SecuredLocal
+		}
+	case string:
+		return s.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("invalid secured value: %s", b)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration read from json as a duration string like "30s",
+// or as a number of seconds
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", b)
+	}
+
+	return nil
+}
+
+// ProxyAttributes are the passdb extra fields returned with proxy
+// destinations, see
+// https://doc.dovecot.org/configuration_manual/authentication/proxies/
+type ProxyAttributes struct {
+	Port         int      `json:"port,omitempty"`
+	SSL          string   `json:"ssl,omitempty"`
+	StartTLS     string   `json:"starttls,omitempty"`
+	HostIP       string   `json:"hostip,omitempty"`
+	Destuser     string   `json:"destuser,omitempty"`
+	Master       string   `json:"master,omitempty"`
+	ProxyMech    string   `json:"proxy_mech,omitempty"`
+	ProxyTimeout Duration `json:"proxy_timeout,omitempty"`
+	ProxyRefresh Duration `json:"proxy_refresh,omitempty"`
+
+	// booleans are pointers, so overrides can turn them off
+	ProxyNopipelining *bool `json:"proxy_nopipelining,omitempty"`
+	ProxyNotTrying    *bool `json:"proxy_not_trying,omitempty"`
+
+	PassdbAttributes
+
+	// Extra holds arbitrary additional fields, overriding typed ones
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// Validate checks the attributes for values Dovecot would not accept
+func (p *ProxyAttributes) Validate() error {
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", p.Port)
+	}
+
+	if p.HostIP != "" {
+		if _, err := netip.ParseAddr(p.HostIP); err != nil {
+			return fmt.Errorf("invalid hostip: %q", p.HostIP)
+		}
+	}
+
+	for name, value := range map[string]string{"ssl": p.SSL, "starttls": p.StartTLS} {
+		if value != "" && value != "yes" && value != "any-cert" {
+			return fmt.Errorf("invalid %s value: %q, must be yes or any-cert", name, value)
+		}
+	}
+
+	if p.ProxyTimeout < 0 || p.ProxyRefresh < 0 {
+		return fmt.Errorf("negative durations are invalid")
+	}
+
+	for key := range p.Extra {
+		if key == "" || strings.ContainsAny(key, "= \t\r\n") {
+			return fmt.Errorf("invalid extra field name: %q", key)
+		}
+	}
+
+	return p.PassdbAttributes.Validate()
+}
+
+// Merge returns p overridden by the set fields of o
+func (p ProxyAttributes) Merge(o ProxyAttributes) ProxyAttributes {
+	if o.Port != 0 {
+		p.Port = o.Port
+	}
+	if o.SSL != "" {
+		p.SSL = o.SSL
+	}
+	if o.StartTLS != "" {
+		p.StartTLS = o.StartTLS
+	}
+	if o.HostIP != "" {
+		p.HostIP = o.HostIP
+	}
+	if o.Destuser != "" {
+		p.Destuser = o.Destuser
+	}
+	if o.Master != "" {
+		p.Master = o.Master
+	}
+	if o.ProxyMech != "" {
+		p.ProxyMech = o.ProxyMech
+	}
+	if o.ProxyTimeout != 0 {
+		p.ProxyTimeout = o.ProxyTimeout
+	}
+	if o.ProxyRefresh != 0 {
+		p.ProxyRefresh = o.ProxyRefresh
+	}
+	if o.ProxyNopipelining != nil {
+		p.ProxyNopipelining = o.ProxyNopipelining
+	}
+	if o.ProxyNotTrying != nil {
+		p.ProxyNotTrying = o.ProxyNotTrying
+	}
+	p.PassdbAttributes = p.PassdbAttributes.Merge(o.PassdbAttributes)
+
+	if len(o.Extra) > 0 {
+		extra := make(map[string]string, len(p.Extra)+len(o.Extra))
+		maps.Copy(extra, p.Extra)
+		maps.Copy(extra, o.Extra)
+		p.Extra = extra
+	}
+
+	return p
+}
@@ -0,0 +1,195 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestProxyAttributesMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		p, o ProxyAttributes
+		want ProxyAttributes
+	}{
+		{
+			name: "unset keeps",
+			p:    ProxyAttributes{Port: 143, ProxyNopipelining: boolPtr(true), PassdbAttributes: PassdbAttributes{Nodelay: boolPtr(true)}},
+			want: ProxyAttributes{Port: 143, ProxyNopipelining: boolPtr(true), PassdbAttributes: PassdbAttributes{Nodelay: boolPtr(true)}},
+		},
+		{
+			name: "set overrides",
+			p:    ProxyAttributes{Port: 143, SSL: "yes", HostIP: "10.0.0.1"},
+			o:    ProxyAttributes{Port: 993, HostIP: "10.0.0.2", PassdbAttributes: PassdbAttributes{AllowNets: "192.0.2.0/24"}},
+			want: ProxyAttributes{Port: 993, SSL: "yes", HostIP: "10.0.0.2", PassdbAttributes: PassdbAttributes{AllowNets: "192.0.2.0/24"}},
+		},
+		{
+			name: "booleans turned off",
+			p:    ProxyAttributes{ProxyNopipelining: boolPtr(true), ProxyNotTrying: boolPtr(true), PassdbAttributes: PassdbAttributes{Nodelay: boolPtr(true)}},
+			o:    ProxyAttributes{ProxyNopipelining: boolPtr(false), ProxyNotTrying: boolPtr(false), PassdbAttributes: PassdbAttributes{Nodelay: boolPtr(false)}},
+			want: ProxyAttributes{ProxyNopipelining: boolPtr(false), ProxyNotTrying: boolPtr(false), PassdbAttributes: PassdbAttributes{Nodelay: boolPtr(false)}},
+		},
+		{
+			name: "extra merged",
+			p:    ProxyAttributes{Extra: map[string]string{"a": "1", "b": "1"}},
+			o:    ProxyAttributes{Extra: map[string]string{"b": "2"}},
+			want: ProxyAttributes{Extra: map[string]string{"a": "1", "b": "2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.Merge(tt.o); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyAttributesValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs ProxyAttributes
+		err   bool
+	}{
+		{name: "empty"},
+		{name: "valid", attrs: ProxyAttributes{Port: 993, SSL: "any-cert", HostIP: "2001:db8::1", Extra: map[string]string{"proxy_noauth": "yes"}}},
+		{name: "port", attrs: ProxyAttributes{Port: 65536}, err: true},
+		{name: "ssl", attrs: ProxyAttributes{SSL: "no"}, err: true},
+		{name: "hostip", attrs: ProxyAttributes{HostIP: "backend.example.com"}, err: true},
+		{name: "hostip with field", attrs: ProxyAttributes{HostIP: "10.0.0.1 nopassword=y"}, err: true},
+		{name: "negative duration", attrs: ProxyAttributes{ProxyTimeout: -1}, err: true},
+		{name: "extra name", attrs: ProxyAttributes{Extra: map[string]string{"a=b": "c"}}, err: true},
+		{name: "allow_nets", attrs: ProxyAttributes{PassdbAttributes: PassdbAttributes{AllowNets: "local, 192.0.2.0/24,2001:db8::1"}}},
+		{name: "invalid allow_nets", attrs: ProxyAttributes{PassdbAttributes: PassdbAttributes{AllowNets: "192.0.2.0/33"}}, err: true},
+		{name: "invalid allow_real_nets", attrs: ProxyAttributes{PassdbAttributes: PassdbAttributes{AllowRealNets: "example.com"}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.attrs.Validate(); (err != nil) != tt.err {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestProxyAttributesUnmarshal(t *testing.T) {
+	var attrs ProxyAttributes
+	if err := json.Unmarshal([]byte(`{"port":993,"proxy_timeout":"1m","proxy_refresh":30,"proxy_not_trying":false,"nodelay":true}`), &attrs); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ProxyAttributes{
+		Port:             993,
+		ProxyTimeout:     Duration(time.Minute),
+		ProxyRefresh:     Duration(30 * time.Second),
+		ProxyNotTrying:   boolPtr(false),
+		PassdbAttributes: PassdbAttributes{Nodelay: boolPtr(true)},
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("got %+v, want %+v", attrs, want)
+	}
+}
+
+func TestResponseAttributesFields(t *testing.T) {
+	attrs := ResponseAttributes{
+		Proxy: true,
+		Host:  "10.0.0.1",
+		ProxyAttributes: ProxyAttributes{
+			Port:              993,
+			ProxyTimeout:      Duration(1500 * time.Millisecond),
+			ProxyNopipelining: boolPtr(true),
+			ProxyNotTrying:    boolPtr(false),
+			PassdbAttributes:  PassdbAttributes{AllowNets: "192.0.2.0/24"},
+			Extra:             map[string]string{"proxy_noauth": "yes"},
+		},
+		UserdbAttributes: UserdbAttributes{
+			Mail:       "maildir:~/Maildir",
+			QuotaBytes: 1024,
+		},
+	}
+
+	tests := []struct {
+		version Version
+		want    string
+	}{
+		{
+			version: Version23,
+			want:    "allow_nets=192.0.2.0/24 host=10.0.0.1 mail=maildir:~/Maildir port=993 proxy=y proxy_noauth=yes proxy_nopipelining=y proxy_timeout=2 quota_rule=*:storage=1024B",
+		},
+		{
+			version: Version24,
+			want:    "allow_nets=192.0.2.0/24 host=10.0.0.1 mail_driver=maildir mail_path=~/Maildir port=993 proxy=yes proxy_noauth=yes proxy_nopipelining=yes proxy_timeout=1500ms quota_storage_size=1024",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.version), func(t *testing.T) {
+			attrs.Version = tt.version
+
+			fields, err := attrs.Fields()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Join(fields, " "); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseAttributesMarshalJSON(t *testing.T) {
+	attrs := ResponseAttributes{
+		Proxy: true,
+		ProxyAttributes: ProxyAttributes{
+			ProxyNopipelining: boolPtr(true),
+			ProxyNotTrying:    boolPtr(false),
+		},
+	}
+
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"proxy":true,"proxy_nopipelining":true}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
@@ -29,39 +29,184 @@ SUCH DAMAGE.
 
 package dovecot
 
+import (
+	"encoding"
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits of request fields
+const (
+	maxUserLength     = 255
+	maxPasswordLength = 8192
+	maxFieldLength    = 1024
+)
+
+// Request is an authentication request, as sent by the Lua scripts and
+// the line based protocols
 type Request struct {
-	AuthDomain    string `json:"auth_domain"`
-	AuthUser      string `json:"auth_user"`
-	AuthUsername  string `json:"auth_username"`
-	Cert          string `json:"cert"`
-	ClientId      string `json:"client_id"`
-	Domain        string `json:"domain"`
-	DomainFirst   string `json:"domain_first"`
-	DomainLast    string `json:"domain_last"`
-	Home          string `json:"home"`
-	Lip           string `json:"lip"`
-	LocalName     string `json:"local_name"`
-	LoginDomain   string `json:"login_domain"`
-	LoginUser     string `json:"login_user"`
-	LoginUsername string `json:"login_username"`
-	Lport         string `json:"lport"`
-	MasterUser    string `json:"master_user"`
-	Mech          string `json:"mech"`
-	OrigDomain    string `json:"orig_domain"`
-	OrigUser      string `json:"orig_user"`
-	OrigUsername  string `json:"orig_username"`
-	Password      string `json:"password"`
-	Pid           string `json:"pid"`
-	RealLip       string `json:"real_lip"`
-	RealLport     string `json:"real_lport"`
-	RealRip       string `json:"real_rip"`
-	RealRport     string `json:"real_rport"`
-	Rip           string `json:"rip"`
-	Rport         string `json:"rport"`
-	Secured       string `json:"secured"`
-	Service       string `json:"service"`
-	Session       string `json:"session"`
-	SessionPid    string `json:"session_pid"`
-	User          string `json:"user"`
-	Username      string `json:"username"`
+	AuthDomain    string     `json:"auth_domain"`
+	AuthUser      string     `json:"auth_user"`
+	AuthUsername  string     `json:"auth_username"`
+	Cert          string     `json:"cert"`
+	ClientId      string     `json:"client_id"`
+	Domain        string     `json:"domain"`
+	DomainFirst   string     `json:"domain_first"`
+	DomainLast    string     `json:"domain_last"`
+	Home          string     `json:"home"`
+	Lip           netip.Addr `json:"lip"`
+	LocalName     string     `json:"local_name"`
+	LoginDomain   string     `json:"login_domain"`
+	LoginUser     string     `json:"login_user"`
+	LoginUsername string     `json:"login_username"`
+	Lport         Port       `json:"lport"`
+	MasterUser    string     `json:"master_user"`
+	Mech          string     `json:"mech"`
+	OrigDomain    string     `json:"orig_domain"`
+	OrigUser      string     `json:"orig_user"`
+	OrigUsername  string     `json:"orig_username"`
+	Password      string     `json:"password"`
+	Pid           string     `json:"pid"`
+	RealLip       netip.Addr `json:"real_lip"`
+	RealLport     Port       `json:"real_lport"`
+	RealRip       netip.Addr `json:"real_rip"`
+	RealRport     Port       `json:"real_rport"`
+	Rip           netip.Addr `json:"rip"`
+	Rport         Port       `json:"rport"`
+	Secured       Secured    `json:"secured"`
+	Service       string     `json:"service"`
+	Session       string     `json:"session"`
+	SessionPid    string     `json:"session_pid"`
+	User          string     `json:"user"`
+	Username      string     `json:"username"`
+}
+
+// RequestError reports a malformed request
+type RequestError struct {
+	// Field is the Dovecot name of the invalid field, empty if the request
+	// could not be parsed at all
+	Field string
+
+	Reason string
+}
+
+func (e *RequestError) Error() string {
+	if e.Field == "" {
+		return "invalid request: " + e.Reason
+	}
+
+	return "invalid " + e.Field + ": " + e.Reason
+}
+
+// ParseRequest decodes a json request, filling Username and Domain from
+// User when missing
+func ParseRequest(data []byte) (*Request, error) {
+	request := &Request{}
+	if err := json.Unmarshal(data, request); err != nil {
+		return nil, &RequestError{Reason: err.Error()}
+	}
+
+	request.fillUser()
+
+	return request, nil
+}
+
+var requestFields = func() map[string]int {
+	fields := make(map[string]int)
+
+	t := reflect.TypeFor[Request]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+	}
+
+	return fields
+}()
+
+// Set sets a field by its Dovecot name, filling Username and Domain from
+// user when missing. Unknown names are skipped without an error, a
+// RequestError is returned for values not valid for the field.
+func (r *Request) Set(key, value string) error {
+	i, ok := requestFields[key]
+	if !ok {
+		return nil
+	}
+
+	field := reflect.ValueOf(r).Elem().Field(i)
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(value)); err != nil {
+			return &RequestError{Field: key, Reason: err.Error()}
+		}
+
+		return nil
+	}
+
+	field.SetString(value)
+
+	if key == "user" {
+		r.fillUser()
+	}
+
+	return nil
+}
+
+// SetUser sets User, along with Username and Domain split from it
+func (r *Request) SetUser(user string) {
+	r.User = user
+	r.Username, r.Domain = SplitUser(user)
+}
+
+// fillUser fills Username and Domain from User when missing
+func (r *Request) fillUser() {
+	if r.Username == "" {
+		r.Username, r.Domain = SplitUser(r.User)
+	}
+}
+
+// Validate checks the request for values not to be passed on
+func (r *Request) Validate() error {
+	if r.User == "" {
+		return &RequestError{Field: "user", Reason: "empty"}
+	}
+	if len(r.User) > maxUserLength {
+		return &RequestError{Field: "user", Reason: "too long"}
+	}
+	if strings.ContainsFunc(r.User, unicode.IsControl) {
+		return &RequestError{Field: "user", Reason: "contains control characters"}
+	}
+
+	if len(r.Password) > maxPasswordLength {
+		return &RequestError{Field: "password", Reason: "too long"}
+	}
+
+	// passwords are passed on as they are, even if not valid UTF-8
+	v := reflect.ValueOf(r).Elem()
+	for name, i := range requestFields {
+		field := v.Field(i)
+		if field.Kind() != reflect.String || name == "password" {
+			continue
+		}
+
+		if len(field.String()) > maxFieldLength {
+			return &RequestError{Field: name, Reason: "too long"}
+		}
+		if !utf8.ValidString(field.String()) {
+			return &RequestError{Field: name, Reason: "invalid UTF-8"}
+		}
+	}
+
+	return nil
+}
+
+// SplitUser splits a user name into its local part and domain at the last @
+func SplitUser(user string) (username, domain string) {
+	if at := strings.LastIndexByte(user, '@'); at >= 0 {
+		return user[:at], user[at+1:]
+	}
+
+	return user, ""
 }
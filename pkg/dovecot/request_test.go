@@ -0,0 +1,214 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     Request
+		errField string
+		err      bool
+	}{
+		{
+			name: "user split",
+			data: `{"user":"a@example.com","service":"imap","rip":"192.0.2.1","lport":"143"}`,
+			want: Request{User: "a@example.com", Username: "a", Domain: "example.com", Service: "imap", Rip: netip.MustParseAddr("192.0.2.1"), Lport: 143},
+		},
+		{
+			name: "username kept",
+			data: `{"user":"a@example.com","username":"b","domain":"example.org"}`,
+			want: Request{User: "a@example.com", Username: "b", Domain: "example.org"},
+		},
+		{
+			name: "numeric port and secured",
+			data: `{"user":"a","lport":993,"secured":"TLS"}`,
+			want: Request{User: "a", Username: "a", Lport: 993, Secured: SecuredTLS},
+		},
+		{
+			name: "invalid address",
+			data: `{"user":"a","rip":"example.com"}`,
+			err:  true,
+		},
+		{
+			name: "invalid json",
+			data: `{"user":`,
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRequest([]byte(tt.data))
+			if tt.err {
+				var requestError *RequestError
+				if !errors.As(err, &requestError) {
+					t.Errorf("err = %v, want a RequestError", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		params [][2]string
+		want   Request
+		err    string
+	}{
+		{
+			name:   "user split",
+			params: [][2]string{{"user", "a@example.com"}, {"service", "imap"}},
+			want:   Request{User: "a@example.com", Username: "a", Domain: "example.com", Service: "imap"},
+		},
+		{
+			name:   "username before user kept",
+			params: [][2]string{{"username", "b"}, {"user", "a@example.com"}},
+			want:   Request{User: "a@example.com", Username: "b"},
+		},
+		{
+			name:   "typed fields",
+			params: [][2]string{{"rip", "2001:db8::1"}, {"rport", "1234"}, {"secured", "secured"}},
+			want:   Request{Rip: netip.MustParseAddr("2001:db8::1"), Rport: 1234, Secured: SecuredLocal},
+		},
+		{
+			name:   "empty address",
+			params: [][2]string{{"lip", ""}},
+		},
+		{
+			name:   "unknown skipped",
+			params: [][2]string{{"unknown", "x"}},
+		},
+		{
+			name:   "invalid address",
+			params: [][2]string{{"rip", "x"}},
+			err:    "rip",
+		},
+		{
+			name:   "invalid port",
+			params: [][2]string{{"lport", "65536"}},
+			err:    "lport",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Request
+
+			for _, param := range tt.params {
+				err := got.Set(param[0], param[1])
+				if tt.err != "" {
+					var requestError *RequestError
+					if !errors.As(err, &requestError) || requestError.Field != tt.err {
+						t.Errorf("err = %v, want a RequestError of %s", err, tt.err)
+					}
+
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+		field   string
+	}{
+		{name: "valid", request: Request{User: "a@example.com", Password: "\xff"}},
+		{name: "empty user", request: Request{}, field: "user"},
+		{name: "long user", request: Request{User: strings.Repeat("a", maxUserLength+1)}, field: "user"},
+		{name: "control characters", request: Request{User: "a\tb"}, field: "user"},
+		{name: "long password", request: Request{User: "a", Password: strings.Repeat("a", maxPasswordLength+1)}, field: "password"},
+		{name: "long field", request: Request{User: "a", Service: strings.Repeat("a", maxFieldLength+1)}, field: "service"},
+		{name: "invalid UTF-8", request: Request{User: "a", Session: "\xff"}, field: "session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+
+			err := request.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("err = %v", err)
+				}
+			} else {
+				var requestError *RequestError
+				if !errors.As(err, &requestError) || requestError.Field != tt.field {
+					t.Errorf("err = %v, want a RequestError of %s", err, tt.field)
+				}
+			}
+
+			// validation has no side effects
+			if request != tt.request {
+				t.Errorf("request changed to %+v", request)
+			}
+		})
+	}
+}
+
+func TestSplitUser(t *testing.T) {
+	for user, want := range map[string][2]string{
+		"a@example.com":   {"a", "example.com"},
+		"a@b@example.com": {"a@b", "example.com"},
+		"a":               {"a", ""},
+		"@example.com":    {"", "example.com"},
+	} {
+		if username, domain := SplitUser(user); username != want[0] || domain != want[1] {
+			t.Errorf("%s: got %q, %q", user, username, domain)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import "testing"
+
+func TestTabEscape(t *testing.T) {
+	tests := []struct {
+		value   string
+		escaped string
+	}{
+		{"plain", "plain"},
+		{"a\tb", "a\x01tb"},
+		{"a\r\nb", "a\x01r\x01nb"},
+		{"\x01", "\x011"},
+		{"a\x00b", "a\x010b"},
+		{"\x01t", "\x011t"},
+	}
+
+	for _, tt := range tests {
+		if escaped := TabEscape(tt.value); escaped != tt.escaped {
+			t.Errorf("TabEscape(%q) = %q, want %q", tt.value, escaped, tt.escaped)
+		}
+
+		if value := TabUnescape(tt.escaped); value != tt.value {
+			t.Errorf("TabUnescape(%q) = %q, want %q", tt.escaped, value, tt.value)
+		}
+	}
+}
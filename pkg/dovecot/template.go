@@ -0,0 +1,104 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Template is a text referring to request fields by their Dovecot names,
+// like %{username}
+type Template struct {
+	literals []string
+	fields   []int
+}
+
+// ParseTemplate parses a template, unknown fields are rejected
+func ParseTemplate(text string) (*Template, error) {
+	t := &Template{}
+
+	for {
+		start := strings.Index(text, "%{")
+		if start < 0 {
+			t.literals = append(t.literals, text)
+
+			return t, nil
+		}
+
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated field reference: %q", text[start:])
+		}
+
+		name := text[start+2 : start+end]
+		i, ok := requestFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown request field: %q", name)
+		}
+
+		t.literals = append(t.literals, text[:start])
+		t.fields = append(t.fields, i)
+		text = text[start+end+1:]
+	}
+}
+
+// Expand returns the template with the fields of r substituted
+func (t *Template) Expand(r *Request) string {
+	var b strings.Builder
+
+	v := reflect.ValueOf(r).Elem()
+	for i, literal := range t.literals {
+		b.WriteString(literal)
+
+		if i < len(t.fields) {
+			b.WriteString(fieldString(v.Field(t.fields[i])))
+		}
+	}
+
+	return b.String()
+}
+
+// fieldString formats a request field
+func fieldString(field reflect.Value) string {
+	if m, ok := field.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+
+	if field.Kind() == reflect.String {
+		return field.String()
+	}
+
+	return fmt.Sprint(field.Interface())
+}
@@ -0,0 +1,181 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is a Dovecot release series, selecting how attributes are
+// serialized
+type Version string
+
+const (
+	Version23 Version = "2.3"
+	Version24 Version = "2.4"
+)
+
+// ParseVersion parses 2.3 or 2.4 into a Version
+func ParseVersion(version string) (Version, error) {
+	switch v := Version(version); v {
+	case Version23, Version24:
+		return v, nil
+	}
+
+	return "", fmt.Errorf("unsupported dovecot version: %q", version)
+}
+
+// formatDuration returns a duration as seconds for 2.3, and with a time unit
+// for 2.4
+func (v Version) formatDuration(d Duration) any {
+	td := time.Duration(d)
+
+	if v == Version24 {
+		if td%time.Second == 0 {
+			return fmt.Sprintf("%ds", td/time.Second)
+		}
+
+		return fmt.Sprintf("%dms", td.Milliseconds())
+	}
+
+	return int64(math.Ceil(td.Seconds()))
+}
+
+// formatBool returns the value of a set boolean field
+func (v Version) formatBool() string {
+	if v == Version24 {
+		return "yes"
+	}
+
+	return "y"
+}
+
+// mailOptions24 are the 2.4 settings replacing the options of mail
+// locations
+var mailOptions24 = map[string]string{
+	"ALT":           "mail_alt_path",
+	"CONTROL":       "mail_control_path",
+	"DIRNAME":       "mailbox_directory_name",
+	"INBOX":         "mail_inbox_path",
+	"INDEX":         "mail_index_path",
+	"INDEXPVT":      "mail_index_private_path",
+	"LAYOUT":        "mailbox_list_layout",
+	"LISTINDEX":     "mailbox_list_index_prefix",
+	"MAILBOXDIR":    "mailbox_root_directory_name",
+	"SUBSCRIPTIONS": "mailbox_subscriptions_filename",
+	"VOLATILEDIR":   "mail_volatile_path",
+}
+
+// mailFlags24 are the 2.4 boolean settings replacing the flags of mail
+// locations
+var mailFlags24 = map[string]string{
+	"ITERINDEX":   "mailbox_list_iter_from_index_dir",
+	"NO-NOSELECT": "mailbox_list_drop_noselect",
+	"UTF8":        "mailbox_list_utf8",
+}
+
+// mailFields returns a mail location as the mail field for 2.3. For 2.4 it
+// is split into mail_driver, mail_path and the settings of its options,
+// unknown options are an error.
+func (v Version) mailFields(mail string) (map[string]any, error) {
+	if v != Version24 {
+		return map[string]any{"mail": mail}, nil
+	}
+
+	driver, location, found := strings.Cut(mail, ":")
+	if !found {
+		return map[string]any{"mail_path": mail}, nil
+	}
+
+	parts := strings.Split(location, ":")
+	fields := map[string]any{"mail_driver": driver, "mail_path": parts[0]}
+
+	for _, option := range parts[1:] {
+		key, value, found := strings.Cut(option, "=")
+		if setting, ok := mailOptions24[key]; ok && found {
+			fields[setting] = value
+		} else if setting, ok := mailFlags24[key]; ok && !found {
+			fields[setting] = v.formatBool()
+		} else {
+			return nil, fmt.Errorf("unsupported mail location option for 2.4: %q", option)
+		}
+	}
+
+	return fields, nil
+}
+
+// quotaFields returns a storage quota as a quota_rule for 2.3, and as
+// quota_storage_size for 2.4
+func (v Version) quotaFields(bytes int64) map[string]any {
+	if v == Version24 {
+		return map[string]any{"quota_storage_size": strconv.FormatInt(bytes, 10)}
+	}
+
+	return map[string]any{"quota_rule": fmt.Sprintf("*:storage=%dB", bytes)}
+}
+
+// requestVariables24 are the auth variables renamed in 2.4
+var requestVariables24 = map[string]string{
+	"lip":           "local_ip",
+	"rip":           "remote_ip",
+	"lport":         "local_port",
+	"rport":         "remote_port",
+	"real_lip":      "real_local_ip",
+	"real_rip":      "real_remote_ip",
+	"real_lport":    "real_local_port",
+	"real_rport":    "real_remote_port",
+	"service":       "protocol",
+	"mech":          "mechanism",
+	"orig_user":     "original_user",
+	"orig_username": "original_username",
+	"orig_domain":   "original_domain",
+}
+
+// requestVariables returns the request fields with the auth variables they
+// are read from in the Lua scripts, sorted by field
+func (v Version) requestVariables() []requestVariable {
+	variables := make([]requestVariable, 0, len(requestFields))
+	for _, field := range slices.Sorted(maps.Keys(requestFields)) {
+		variable := field
+		if renamed, ok := requestVariables24[field]; ok && v == Version24 {
+			variable = renamed
+		}
+
+		variables = append(variables, requestVariable{Field: field, Variable: variable})
+	}
+
+	return variables
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package dovecot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMailFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		version Version
+		mail    string
+		want    map[string]any
+		err     bool
+	}{
+		{
+			name:    "2.3 location",
+			version: Version23,
+			mail:    "maildir:~/Maildir:LAYOUT=fs",
+			want:    map[string]any{"mail": "maildir:~/Maildir:LAYOUT=fs"},
+		},
+		{
+			name:    "2.4 driver and path",
+			version: Version24,
+			mail:    "maildir:/var/mail/example.com/user/",
+			want:    map[string]any{"mail_driver": "maildir", "mail_path": "/var/mail/example.com/user/"},
+		},
+		{
+			name:    "2.4 path only",
+			version: Version24,
+			mail:    "/var/mail/user",
+			want:    map[string]any{"mail_path": "/var/mail/user"},
+		},
+		{
+			name:    "2.4 options",
+			version: Version24,
+			mail:    "maildir:~/Maildir:LAYOUT=fs:INDEX=/var/index/user:UTF8",
+			want: map[string]any{
+				"mail_driver":         "maildir",
+				"mail_path":           "~/Maildir",
+				"mailbox_list_layout": "fs",
+				"mail_index_path":     "/var/index/user",
+				"mailbox_list_utf8":   "yes",
+			},
+		},
+		{
+			name:    "2.4 empty path",
+			version: Version24,
+			mail:    "mdbox::INDEX=MEMORY",
+			want:    map[string]any{"mail_driver": "mdbox", "mail_path": "", "mail_index_path": "MEMORY"},
+		},
+		{
+			name:    "2.4 unknown option",
+			version: Version24,
+			mail:    "maildir:~/Maildir:FOO=bar",
+			err:     true,
+		},
+		{
+			name:    "2.4 option without value",
+			version: Version24,
+			mail:    "maildir:~/Maildir:LAYOUT",
+			err:     true,
+		},
+		{
+			name:    "2.4 flag with value",
+			version: Version24,
+			mail:    "maildir:~/Maildir:UTF8=yes",
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.version.mailFields(tt.mail)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v", err)
+			}
+
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for version, valid := range map[string]bool{"2.3": true, "2.4": true, "2.2": false, "": false} {
+		if _, err := ParseVersion(version); (err == nil) != valid {
+			t.Errorf("%q: err = %v", version, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package mailbox
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned for nonexistent mailboxes
+var ErrNotFound = errors.New("mailbox not found")
+
+// Mailbox is a mail account
+type Mailbox struct {
+	Username string
+	Domain   string
+
+	// Password is the password hash in Dovecot's {SCHEME}hash format
+	Password string
+
+	// Active tells whether the mailbox is enabled
+	Active bool
+
+	// DomainActive tells whether the domain of the mailbox is enabled
+	DomainActive bool
+
+	// Maildir is the path of the maildir, relative to the mail root
+	Maildir string
+
+	// Quota is the storage quota in bytes, 0 is unlimited
+	Quota int64
+}
+
+// Store holds mailboxes
+type Store interface {
+	// Get returns the mailbox of a user, or ErrNotFound
+	Get(context.Context, string) (*Mailbox, error)
+}
+
+// Resolver resolves addresses to the mailboxes receiving them
+type Resolver interface {
+	// Resolve returns the mailbox of an address, or the address itself if
+	// it does not resolve to another mailbox
+	Resolve(context.Context, string) (string, error)
+}
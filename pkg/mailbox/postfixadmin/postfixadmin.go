@@ -0,0 +1,72 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package postfixadmin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go-dovecot-director/pkg/mailbox"
+)
+
+type postfixadminStore struct {
+	pg *pgxpool.Pool
+}
+
+// New returns a store reading Postfixadmin's mailbox and domain tables,
+// mailboxes of nonexistent domains are not found
+func New(pg *pgxpool.Pool) mailbox.Store {
+	return &postfixadminStore{
+		pg: pg,
+	}
+}
+
+// Get implements mailbox.Store.
+func (p *postfixadminStore) Get(ctx context.Context, username string) (*mailbox.Mailbox, error) {
+	m := &mailbox.Mailbox{}
+
+	err := p.pg.QueryRow(ctx,
+		"SELECT m.username, m.domain, m.password, m.active, d.active, m.maildir, m.quota "+
+			"FROM mailbox m JOIN domain d ON d.domain = m.domain "+
+			"WHERE m.username = $1",
+		username,
+	).Scan(&m.Username, &m.Domain, &m.Password, &m.Active, &m.DomainActive, &m.Maildir, &m.Quota)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, mailbox.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package postfixadmin
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go-dovecot-director/pkg/mailbox"
+)
+
+type postfixadminResolver struct {
+	pg      *pgxpool.Pool
+	aliases bool
+}
+
+// NewResolver returns a resolver following Postfixadmin's active alias
+// domains, and aliases with a single mailbox target if aliases is set
+func NewResolver(pg *pgxpool.Pool, aliases bool) mailbox.Resolver {
+	return &postfixadminResolver{
+		pg:      pg,
+		aliases: aliases,
+	}
+}
+
+// Resolve implements mailbox.Resolver.
+func (p *postfixadminResolver) Resolve(ctx context.Context, address string) (string, error) {
+	ok, err := p.exists(ctx, address)
+	if ok || err != nil {
+		return address, err
+	}
+
+	resolved := address
+
+	if at := strings.LastIndexByte(address, '@'); at >= 0 {
+		var target string
+
+		err = p.pg.QueryRow(ctx,
+			"SELECT target_domain FROM alias_domain WHERE alias_domain = $1 AND active",
+			address[at+1:],
+		).Scan(&target)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return "", err
+		}
+
+		if err == nil {
+			resolved = address[:at+1] + target
+			if ok, err = p.exists(ctx, resolved); ok || err != nil {
+				return resolved, err
+			}
+		}
+	}
+
+	if !p.aliases {
+		return address, nil
+	}
+
+	var destination string
+
+	err = p.pg.QueryRow(ctx,
+		"SELECT goto FROM alias WHERE address = $1 AND active",
+		resolved,
+	).Scan(&destination)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return address, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// aliases delivering to several addresses have no single mailbox
+	destination = strings.TrimSpace(destination)
+	if destination == "" || strings.Contains(destination, ",") {
+		return address, nil
+	}
+
+	if ok, err = p.exists(ctx, destination); !ok || err != nil {
+		return address, err
+	}
+
+	return destination, nil
+}
+
+// exists tells whether address is a mailbox
+func (p *postfixadminResolver) exists(ctx context.Context, address string) (bool, error) {
+	var ok bool
+
+	err := p.pg.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM mailbox WHERE username = $1)",
+		address,
+	).Scan(&ok)
+
+	return ok, err
+}
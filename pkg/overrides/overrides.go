@@ -0,0 +1,156 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package overrides
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scope selects what an override applies to
+type Scope string
+
+// Scopes in the order of inheritance, later ones take precedence
+const (
+	ScopeBackend Scope = "backend"
+	ScopeDomain  Scope = "domain"
+	ScopeUser    Scope = "user"
+)
+
+// Database selects the responses an override is merged into
+type Database string
+
+const (
+	DatabaseAll    Database = "all"
+	DatabasePassdb Database = "passdb"
+	DatabaseUserdb Database = "userdb"
+)
+
+// allowedKeys are the extra fields overrides may set, ones deciding on
+// authentication or routing like host, proxy, nopassword or pass are not
+// among them
+var allowedKeys = map[string]bool{
+	"allow_nets":          true,
+	"allow_real_nets":     true,
+	"proxy_timeout":       true,
+	"proxy_refresh":       true,
+	"proxy_nopipelining":  true,
+	"proxy_not_trying":    true,
+	"mail_plugins":        true,
+	"quota_storage_size":  true,
+	"quota_message_count": true,
+}
+
+// allowedPrefixes are the prefixes of extra fields overrides may set
+var allowedPrefixes = []string{
+	"quota_rule",
+	"namespace/",
+}
+
+// Allowed reports whether overrides may set the extra field key
+func Allowed(key string) bool {
+	if allowedKeys[key] {
+		return true
+	}
+
+	for _, prefix := range allowedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Override is an extra field returned for a backend, domain or user
+type Override struct {
+	Scope    Scope    `json:"scope"`
+	Name     string   `json:"name"`
+	Database Database `json:"db"`
+	Key      string   `json:"key"`
+	Value    string   `json:"value"`
+}
+
+// Validate checks the override for values which could not be returned
+func (o *Override) Validate() error {
+	switch o.Scope {
+	case ScopeBackend, ScopeDomain, ScopeUser:
+	default:
+		return fmt.Errorf("invalid scope: %q", o.Scope)
+	}
+
+	switch o.Database {
+	case DatabaseAll, DatabasePassdb, DatabaseUserdb:
+	default:
+		return fmt.Errorf("invalid db: %q", o.Database)
+	}
+
+	if o.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	if o.Key == "" || strings.ContainsAny(o.Key, "= \t\r\n") {
+		return fmt.Errorf("invalid key: %q", o.Key)
+	}
+
+	if !Allowed(o.Key) {
+		return fmt.Errorf("key not allowed: %q", o.Key)
+	}
+
+	if strings.ContainsAny(o.Value, "\r\n") {
+		return fmt.Errorf("invalid value: %q", o.Value)
+	}
+
+	return nil
+}
+
+// Filter restricts listed overrides, empty fields match everything
+type Filter struct {
+	Scope Scope
+	Name  string
+}
+
+// Store holds overrides
+type Store interface {
+	// Fields returns the overrides of a user on a backend for a database,
+	// user ones take precedence over domain ones, and those over backend
+	// ones. Overrides for a database take precedence over ones for all.
+	Fields(ctx context.Context, db Database, user, domain, backend string) (map[string]string, error)
+
+	// List returns the overrides matching the filter
+	List(context.Context, Filter) ([]Override, error)
+
+	// Set adds or replaces an override
+	Set(context.Context, Override) error
+
+	// Delete removes an override
+	Delete(context.Context, Override) error
+}
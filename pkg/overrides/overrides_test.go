@@ -0,0 +1,67 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package overrides
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		override Override
+		valid    bool
+	}{
+		{name: "allow_nets", override: Override{Scope: ScopeDomain, Name: "example.com", Database: DatabasePassdb, Key: "allow_nets", Value: "192.0.2.0/24"}, valid: true},
+		{name: "quota rule", override: Override{Scope: ScopeUser, Name: "a@example.com", Database: DatabaseUserdb, Key: "quota_rule2", Value: "Trash:storage=+100M"}, valid: true},
+		{name: "namespace", override: Override{Scope: ScopeBackend, Name: "10.0.0.1", Database: DatabaseAll, Key: "namespace/inbox/prefix", Value: "INBOX."}, valid: true},
+		{name: "invalid scope", override: Override{Scope: "server", Name: "x", Database: DatabaseAll, Key: "allow_nets"}},
+		{name: "invalid db", override: Override{Scope: ScopeUser, Name: "x", Database: "any", Key: "allow_nets"}},
+		{name: "missing name", override: Override{Scope: ScopeUser, Database: DatabaseAll, Key: "allow_nets"}},
+		{name: "invalid key", override: Override{Scope: ScopeUser, Name: "x", Database: DatabaseAll, Key: "allow nets"}},
+		{name: "value with newline", override: Override{Scope: ScopeUser, Name: "x", Database: DatabaseAll, Key: "mail_plugins", Value: "quota\nproxy=y"}},
+		{name: "host", override: Override{Scope: ScopeUser, Name: "x", Database: DatabaseAll, Key: "host", Value: "192.0.2.1"}},
+		{name: "proxy", override: Override{Scope: ScopeUser, Name: "x", Database: DatabasePassdb, Key: "proxy", Value: "y"}},
+		{name: "nopassword", override: Override{Scope: ScopeUser, Name: "x", Database: DatabasePassdb, Key: "nopassword", Value: "y"}},
+		{name: "pass", override: Override{Scope: ScopeUser, Name: "x", Database: DatabasePassdb, Key: "pass", Value: "secret"}},
+		{name: "destuser", override: Override{Scope: ScopeUser, Name: "x", Database: DatabasePassdb, Key: "destuser", Value: "b@example.com"}},
+		{name: "master", override: Override{Scope: ScopeUser, Name: "x", Database: DatabasePassdb, Key: "master", Value: "admin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.override.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("err = %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
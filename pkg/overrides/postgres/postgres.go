@@ -0,0 +1,120 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"go-dovecot-director/pkg/overrides"
+)
+
+type postgresStore struct {
+	pg *pgxpool.Pool
+}
+
+// New returns an override store using the director_overrides table
+func New(pg *pgxpool.Pool) overrides.Store {
+	return &postgresStore{
+		pg: pg,
+	}
+}
+
+// Fields implements overrides.Store.
+func (p *postgresStore) Fields(ctx context.Context, db overrides.Database, user, domain, backend string) (map[string]string, error) {
+	rows, err := p.pg.Query(ctx,
+		"SELECT key, value FROM director_overrides "+
+			"WHERE db IN ('all', $1) AND ((scope = 'backend' AND name = $2) OR (scope = 'domain' AND name = $3) OR (scope = 'user' AND name = $4)) "+
+			"ORDER BY CASE scope WHEN 'backend' THEN 0 WHEN 'domain' THEN 1 ELSE 2 END, db = 'all' DESC",
+		db, backend, domain, user,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// later rows override earlier ones
+	fields := make(map[string]string)
+
+	var key, value string
+	_, err = pgx.ForEachRow(rows, []any{&key, &value}, func() error {
+		fields[key] = value
+
+		return nil
+	})
+
+	return fields, err
+}
+
+// List implements overrides.Store.
+func (p *postgresStore) List(ctx context.Context, filter overrides.Filter) ([]overrides.Override, error) {
+	rows, err := p.pg.Query(ctx,
+		"SELECT scope, name, db, key, value FROM director_overrides "+
+			"WHERE ($1 = '' OR scope = $1) AND ($2 = '' OR name = $2) "+
+			"ORDER BY scope, name, db, key",
+		filter.Scope, filter.Name,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []overrides.Override
+
+	var o overrides.Override
+	_, err = pgx.ForEachRow(rows, []any{&o.Scope, &o.Name, &o.Database, &o.Key, &o.Value}, func() error {
+		list = append(list, o)
+
+		return nil
+	})
+
+	return list, err
+}
+
+// Set implements overrides.Store.
+func (p *postgresStore) Set(ctx context.Context, o overrides.Override) error {
+	_, err := p.pg.Exec(ctx,
+		"INSERT INTO director_overrides(scope, name, db, key, value) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (scope, name, db, key) DO UPDATE SET value = EXCLUDED.value",
+		o.Scope, o.Name, o.Database, o.Key, o.Value,
+	)
+
+	return err
+}
+
+// Delete implements overrides.Store.
+func (p *postgresStore) Delete(ctx context.Context, o overrides.Override) error {
+	_, err := p.pg.Exec(ctx,
+		"DELETE FROM director_overrides WHERE scope = $1 AND name = $2 AND db = $3 AND key = $4",
+		o.Scope, o.Name, o.Database, o.Key,
+	)
+
+	return err
+}
@@ -0,0 +1,200 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package passwdfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-dovecot-director/pkg/allocator"
+	"go-dovecot-director/pkg/dovecot"
+	"go-dovecot-director/pkg/pool"
+)
+
+var errStoreNotSupported = errors.New("allocator does not support enumerating mappings")
+
+// Exporter writes all user to backend mappings as a Dovecot passwd-file with
+// proxy destinations, whenever the allocations or the backends change
+type Exporter struct {
+	allocator allocator.Allocator
+	store     allocator.Store
+	pool      pool.Pool
+
+	path     string
+	interval time.Duration
+
+	// content is the last written file, nil before the first write
+	content []byte
+}
+
+func New(a allocator.Allocator, p pool.Pool, path string, interval time.Duration) (*Exporter, error) {
+	store, ok := a.(allocator.Store)
+	if !ok {
+		return nil, errStoreNotSupported
+	}
+
+	return &Exporter{
+		allocator: a,
+		store:     store,
+		pool:      p,
+		path:      path,
+		interval:  interval,
+	}, nil
+}
+
+// Run exports the mappings on changes of the allocations and the pool, and
+// in every interval for changes not notified, until ctx is cancelled
+func (e *Exporter) Run(ctx context.Context) {
+	changes := make(chan struct{}, 1)
+
+	if notifier, ok := e.pool.(pool.Notifier); ok {
+		notifier.Notify(changes)
+	}
+	if listener, ok := e.allocator.(allocator.Listener); ok {
+		go listener.Listen(ctx, changes)
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.export(ctx); err != nil {
+			log.Print(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		case <-ticker.C:
+		}
+	}
+}
+
+// export rewrites the file if the mappings have changed, mappings are
+// written as they are stored unless their backend is dead
+func (e *Exporter) export(ctx context.Context) error {
+	var mappings []allocator.Mapping
+
+	if err := e.store.Iterate(ctx, allocator.Filter{}, func(mapping allocator.Mapping) error {
+		mappings = append(mappings, mapping)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+
+	for _, mapping := range mappings {
+		if strings.ContainsAny(mapping.Username, ":\n") {
+			log.Printf("Skipping invalid username in passwd-file: %q", mapping.Username)
+
+			continue
+		}
+
+		if mapping.Backend == "" || strings.ContainsAny(mapping.Backend, " \t\n") {
+			log.Printf("Skipping invalid backend of %q in passwd-file: %q", mapping.Username, mapping.Backend)
+
+			continue
+		}
+
+		// users on a dead backend are moved to a live one, or left out
+		if alive, _ := e.pool.IsBackendAlive(ctx, mapping.Backend); !alive {
+			backend, err := e.allocator.Allocate(ctx, mapping.Username)
+			if err != nil {
+				log.Printf("Skipping %q on dead backend %s in passwd-file: %+v", mapping.Username, mapping.Backend, err)
+
+				continue
+			}
+
+			mapping.Backend = backend
+		}
+
+		attrs := &dovecot.ResponseAttributes{
+			Nopassword: true,
+			Proxy:      true,
+			Host:       mapping.Backend,
+		}
+
+		fields, err := attrs.Fields()
+		if err != nil {
+			log.Printf("Skipping %q in passwd-file: %+v", mapping.Username, err)
+
+			continue
+		}
+
+		// user:password:uid:gid:(gecos):home:(shell):extra_fields
+		content.WriteString(mapping.Username + ":::::::" + strings.Join(fields, " ") + "\n")
+	}
+
+	if e.content != nil && bytes.Equal(content.Bytes(), e.content) {
+		return nil
+	}
+
+	if err := writeFile(e.path, content.Bytes()); err != nil {
+		return err
+	}
+
+	e.content = append([]byte{}, content.Bytes()...)
+
+	return nil
+}
+
+// writeFile replaces path atomically with data
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err == nil {
+		if err = f.Chmod(0o644); err == nil {
+			err = f.Sync()
+		}
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
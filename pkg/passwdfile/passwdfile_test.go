@@ -0,0 +1,248 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package passwdfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go-dovecot-director/pkg/allocator"
+)
+
+// fakeStore holds mappings in order, and moves users to the backends in
+// moved when allocating
+type fakeStore struct {
+	mu       sync.Mutex
+	mappings []allocator.Mapping
+	moved    map[string]string
+}
+
+func (s *fakeStore) Allocate(_ context.Context, user string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if backend, ok := s.moved[user]; ok {
+		return backend, nil
+	}
+
+	return "", allocator.ErrTemporary
+}
+
+func (s *fakeStore) Lookup(context.Context, string) (string, error) {
+	return "", nil
+}
+
+func (s *fakeStore) Iterate(_ context.Context, _ allocator.Filter, fn func(allocator.Mapping) error) error {
+	s.mu.Lock()
+	mappings := append([]allocator.Mapping(nil), s.mappings...)
+	s.mu.Unlock()
+
+	for _, mapping := range mappings {
+		if err := fn(mapping); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fakePool has the backends not in dead alive, and signals changes when
+// asked to
+type fakePool struct {
+	mu     sync.Mutex
+	dead   map[string]bool
+	notify []chan<- struct{}
+}
+
+func (p *fakePool) Run(context.Context) {}
+
+func (p *fakePool) GetBackend(context.Context) (string, error) {
+	return "", allocator.ErrNoBackends
+}
+
+func (p *fakePool) IsBackendAlive(_ context.Context, backend string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return !p.dead[backend], nil
+}
+
+func (p *fakePool) Notify(ch chan<- struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.notify = append(p.notify, ch)
+}
+
+// changed marks backends dead and signals the change
+func (p *fakePool) changed(dead ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dead = make(map[string]bool)
+	for _, backend := range dead {
+		p.dead[backend] = true
+	}
+
+	for _, ch := range p.notify {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []allocator.Mapping
+		moved    map[string]string
+		want     string
+	}{
+		{
+			name: "empty",
+			want: "",
+		},
+		{
+			name: "stored backends",
+			mappings: []allocator.Mapping{
+				{Username: "a@example.com", Backend: "10.0.0.1"},
+				{Username: "b@example.com", Backend: "10.0.0.2"},
+			},
+			want: "a@example.com:::::::host=10.0.0.1 nopassword=y proxy=y\n" +
+				"b@example.com:::::::host=10.0.0.2 nopassword=y proxy=y\n",
+		},
+		{
+			name: "invalid entries skipped",
+			mappings: []allocator.Mapping{
+				{Username: "a:b@example.com", Backend: "10.0.0.1"},
+				{Username: "c\n@example.com", Backend: "10.0.0.1"},
+				{Username: "d@example.com", Backend: ""},
+				{Username: "e@example.com", Backend: "10.0.0.1 proxy_mech=x"},
+				{Username: "f@example.com", Backend: "10.0.0.3"},
+			},
+			want: "f@example.com:::::::host=10.0.0.3 nopassword=y proxy=y\n",
+		},
+		{
+			name: "dead backends",
+			mappings: []allocator.Mapping{
+				{Username: "a@example.com", Backend: "10.0.0.9"},
+				{Username: "b@example.com", Backend: "10.0.0.9"},
+				{Username: "c@example.com", Backend: "10.0.0.1"},
+			},
+			moved: map[string]string{"a@example.com": "10.0.0.2"},
+			want: "a@example.com:::::::host=10.0.0.2 nopassword=y proxy=y\n" +
+				"c@example.com:::::::host=10.0.0.1 nopassword=y proxy=y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{mappings: tt.mappings, moved: tt.moved}
+			path := filepath.Join(t.TempDir(), "director.passwd")
+
+			e, err := New(store, &fakePool{dead: map[string]bool{"10.0.0.9": true}}, path, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := e.export(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunNotified(t *testing.T) {
+	store := &fakeStore{
+		mappings: []allocator.Mapping{{Username: "a@example.com", Backend: "10.0.0.1"}},
+		moved:    map[string]string{"a@example.com": "10.0.0.2"},
+	}
+	pool := &fakePool{}
+	path := filepath.Join(t.TempDir(), "director.passwd")
+
+	e, err := New(store, pool, path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the stored mapping stays, the pool change moves the user
+	want := "a@example.com:::::::host=10.0.0.2 nopassword=y proxy=y\n"
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pool.changed("10.0.0.1")
+
+		if got, _ := os.ReadFile(path); string(got) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("passwd-file not rewritten after pool change")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewWithoutStore(t *testing.T) {
+	if _, err := New(allocatorOnly{}, &fakePool{}, "director.passwd", time.Hour); err == nil {
+		t.Error("expected error for allocator without store")
+	}
+}
+
+// allocatorOnly cannot enumerate its mappings
+type allocatorOnly struct{}
+
+func (allocatorOnly) Allocate(context.Context, string) (string, error) {
+	return "", allocator.ErrTemporary
+}
@@ -0,0 +1,136 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package password
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownScheme is returned for hashes of unsupported schemes
+var ErrUnknownScheme = errors.New("unknown password scheme")
+
+// Verify tells whether password matches hash. Hashes without a scheme
+// prefix are recognized by their crypt(3) prefix, like Postfixadmin's
+// md5crypt ones.
+func Verify(password, hash string) (bool, error) {
+	scheme := "CRYPT"
+	if strings.HasPrefix(hash, "{") {
+		end := strings.IndexByte(hash, '}')
+		if end < 0 {
+			return false, fmt.Errorf("%w: %q", ErrUnknownScheme, hash)
+		}
+
+		scheme, hash = strings.ToUpper(hash[1:end]), hash[end+1:]
+	}
+
+	switch scheme {
+	case "PLAIN", "CLEAR", "CLEARTEXT":
+		return subtle.ConstantTimeCompare([]byte(password), []byte(hash)) == 1, nil
+	case "SSHA512":
+		return verifySSHA512(password, hash)
+	case "CRYPT", "BLF-CRYPT", "SHA256-CRYPT", "SHA512-CRYPT", "MD5-CRYPT":
+		return verifyCrypt(password, hash)
+	}
+
+	return false, fmt.Errorf("%w: %s", ErrUnknownScheme, scheme)
+}
+
+// verifyCrypt verifies crypt(3) style hashes
+func verifyCrypt(password, hash string) (bool, error) {
+	var computed string
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+
+		return err == nil, err
+	case strings.HasPrefix(hash, md5CryptMagic):
+		computed = md5Crypt(password, hash)
+	case strings.HasPrefix(hash, sha256CryptMagic):
+		computed = shaCrypt(sha256Crypt, password, hash)
+	case strings.HasPrefix(hash, sha512CryptMagic):
+		computed = shaCrypt(sha512Crypt, password, hash)
+	default:
+		return false, fmt.Errorf("%w: unknown crypt hash", ErrUnknownScheme)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+}
+
+// verifySSHA512 verifies base64 encoded salted SHA-512 hashes
+func verifySSHA512(password, hash string) (bool, error) {
+	data, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(data) <= sha512.Size {
+		return false, errors.New("invalid SSHA512 hash")
+	}
+
+	digest, salt := data[:sha512.Size], data[sha512.Size:]
+
+	h := sha512.New()
+	h.Write([]byte(password))
+	h.Write(salt)
+
+	return subtle.ConstantTimeCompare(h.Sum(nil), digest) == 1, nil
+}
+
+// cryptAlphabet is the base64 alphabet of crypt(3)
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptEncode encodes sum in crypt(3)'s base64, taking bytes in the order
+// of groups of three, the last group may be shorter
+func cryptEncode(sum []byte, groups [][]int) string {
+	var out bytes.Buffer
+
+	for _, group := range groups {
+		var w uint
+		for _, i := range group {
+			w = w<<8 | uint(sum[i])
+		}
+
+		// a group of n bytes is encoded in n+1 characters
+		for range len(group) + 1 {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,141 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerify(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		want     bool
+		err      error
+	}{
+		{name: "md5crypt", password: "password", hash: "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", want: true},
+		{name: "md5crypt empty password", password: "", hash: "$1$abcdefgh$M55TzYaaccxVGbptZWaxX/", want: true},
+		{name: "md5crypt mismatch", password: "Password", hash: "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/"},
+		{name: "md5crypt scheme", password: "password", hash: "{MD5-CRYPT}$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", want: true},
+		{name: "sha256crypt", password: "Hello world!", hash: "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", want: true},
+		{
+			name:     "sha256crypt rounds",
+			password: "Hello world!",
+			hash:     "{SHA256-CRYPT}$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA",
+			want:     true,
+		},
+		{
+			name:     "sha256crypt minimum rounds",
+			password: "the minimum number is still observed",
+			hash:     "$5$rounds=1000$roundstoolow$yfvwcWrQ8l/K0DAWyuPMDNHpIVlTQebY9l/gL972bIC",
+			want:     true,
+		},
+		{
+			name:     "sha512crypt",
+			password: "Hello world!",
+			hash:     "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+			want:     true,
+		},
+		{
+			name:     "sha512crypt rounds",
+			password: "Hello world!",
+			hash:     "{SHA512-CRYPT}$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+			want:     true,
+		},
+		{
+			name:     "sha512crypt minimum rounds",
+			password: "the minimum number is still observed",
+			hash:     "$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+			want:     true,
+		},
+		{
+			name:     "sha512crypt mismatch",
+			password: "Hello world",
+			hash:     "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{name: "bcrypt", password: "U*U", hash: "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", want: true},
+		{name: "bcrypt scheme", password: "secret", hash: "{BLF-CRYPT}" + string(bcryptHash), want: true},
+		{name: "bcrypt mismatch", password: "Secret", hash: string(bcryptHash)},
+		{
+			name:     "ssha512",
+			password: "secret",
+			hash:     "{SSHA512}iWwx8naQWtJKIoYOgnIUnOjDVRc/KB/avnmg7rvibFhiLlylVmd8s/TomzyGqQwBOpJzU5z2YBupYIJWW8egvDEyMzQ1Njc4",
+			want:     true,
+		},
+		{
+			name:     "ssha512 mismatch",
+			password: "secret2",
+			hash:     "{SSHA512}iWwx8naQWtJKIoYOgnIUnOjDVRc/KB/avnmg7rvibFhiLlylVmd8s/TomzyGqQwBOpJzU5z2YBupYIJWW8egvDEyMzQ1Njc4",
+		},
+		{name: "plain", password: "secret", hash: "{PLAIN}secret", want: true},
+		{name: "plain lower case scheme", password: "secret", hash: "{plain}secret", want: true},
+		{name: "plain mismatch", password: "secret", hash: "{CLEARTEXT}Secret"},
+		{name: "unknown scheme", password: "secret", hash: "{ARGON2I}$argon2i$v=19$m=65536,t=3,p=1$c2FsdA$aGFzaA", err: ErrUnknownScheme},
+		{name: "unknown crypt", password: "secret", hash: "$7$abc", err: ErrUnknownScheme},
+		{name: "unterminated scheme", password: "secret", hash: "{PLAIN", err: ErrUnknownScheme},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.password, tt.hash)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalidSSHA512(t *testing.T) {
+	for _, hash := range []string{"{SSHA512}not base64!", "{SSHA512}c2hvcnQ="} {
+		if ok, err := Verify("secret", hash); ok || err == nil {
+			t.Errorf("%s: got %v, %v", hash, ok, err)
+		}
+	}
+}
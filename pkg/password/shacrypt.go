@@ -0,0 +1,162 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package password
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+const (
+	sha256CryptMagic = "$5$"
+	sha512CryptMagic = "$6$"
+
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999999999
+)
+
+// shaCryptVariant holds the differences of SHA256-CRYPT and SHA512-CRYPT
+type shaCryptVariant struct {
+	magic  string
+	hash   func() hash.Hash
+	groups [][]int
+}
+
+var sha256Crypt = &shaCryptVariant{
+	magic: sha256CryptMagic,
+	hash:  sha256.New,
+	groups: [][]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+		{31, 30},
+	},
+}
+
+var sha512Crypt = &shaCryptVariant{
+	magic: sha512CryptMagic,
+	hash:  sha512.New,
+	groups: [][]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41}, {63},
+	},
+}
+
+// shaCrypt computes the SHA-CRYPT hash of password with the salt and rounds
+// of hash, as in https://www.akkadia.org/drepper/SHA-crypt.txt
+func shaCrypt(v *shaCryptVariant, password, hash string) string {
+	params := strings.TrimPrefix(hash, v.magic)
+
+	rounds, explicitRounds := shaCryptDefaultRounds, false
+	if r, rest, found := strings.Cut(params, "$"); found && strings.HasPrefix(r, "rounds=") {
+		if n, err := strconv.Atoi(strings.TrimPrefix(r, "rounds=")); err == nil {
+			rounds, explicitRounds = min(max(n, shaCryptMinRounds), shaCryptMaxRounds), true
+			params = rest
+		}
+	}
+
+	salt, _, _ := strings.Cut(params, "$")
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	p, s := []byte(password), []byte(salt)
+
+	b := v.hash()
+	b.Write(p)
+	b.Write(s)
+	b.Write(p)
+	bSum := b.Sum(nil)
+
+	a := v.hash()
+	a.Write(p)
+	a.Write(s)
+	a.Write(repeat(bSum, len(p)))
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(bSum)
+		} else {
+			a.Write(p)
+		}
+	}
+	sum := a.Sum(nil)
+
+	dp := v.hash()
+	for range len(p) {
+		dp.Write(p)
+	}
+	pBytes := repeat(dp.Sum(nil), len(p))
+
+	ds := v.hash()
+	for range 16 + int(sum[0]) {
+		ds.Write(s)
+	}
+	sBytes := repeat(ds.Sum(nil), len(s))
+
+	for i := range rounds {
+		c := v.hash()
+		if i&1 != 0 {
+			c.Write(pBytes)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(sBytes)
+		}
+		if i%7 != 0 {
+			c.Write(pBytes)
+		}
+		if i&1 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(pBytes)
+		}
+		sum = c.Sum(nil)
+	}
+
+	out := v.magic
+	if explicitRounds {
+		out += "rounds=" + strconv.Itoa(rounds) + "$"
+	}
+
+	return out + salt + "$" + cryptEncode(sum, v.groups)
+}
+
+// repeat returns b repeated to n bytes
+func repeat(b []byte, n int) []byte {
+	return bytes.Repeat(b, n/len(b)+1)[:n]
+}
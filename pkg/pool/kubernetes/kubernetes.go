@@ -31,8 +31,8 @@ package kubernetes
 
 import (
 	"context"
-	"errors"
 	"log"
+	"maps"
 	"math/rand"
 	"sync"
 	"time"
@@ -44,16 +44,13 @@ import (
 	"go-dovecot-director/pkg/pool"
 )
 
-var (
-	errNoAvailableBackends = errors.New("no backends are available")
-)
-
 func New(clientset *kubernetes.Clientset, namespace, service string) (pool.Pool, error) {
 	return &serviceMonitor{
 		client:      clientset,
 		namespace:   namespace,
 		service:     service,
 		backendsmap: make(map[string]bool),
+		ports:       make(map[string]map[string]int),
 	}, nil
 }
 
@@ -65,18 +62,38 @@ type serviceMonitor struct {
 	lock         sync.Mutex
 	backendsmap  map[string]bool
 	backendslist []string
+
+	// named ports of backends
+	ports map[string]map[string]int
+
+	// channels notified of changes
+	notify []chan<- struct{}
 }
 
 func (s *serviceMonitor) setAddresses(ep *corev1.Endpoints) {
 	newmap := make(map[string]bool)
 	newlist := make([]string, 0, 5)
+	newports := make(map[string]map[string]int)
 
 	for sidx := range ep.Subsets {
 		subset := &ep.Subsets[sidx]
 
+		ports := make(map[string]int)
+		for pidx := range subset.Ports {
+			if port := &subset.Ports[pidx]; port.Name != "" {
+				ports[port.Name] = int(port.Port)
+			}
+		}
+
 		for aidx := range subset.Addresses {
 			address := &subset.Addresses[aidx]
 
+			// an address may be listed in multiple subsets with different ports
+			if _, ok := newports[address.IP]; !ok {
+				newports[address.IP] = make(map[string]int)
+			}
+			maps.Copy(newports[address.IP], ports)
+
 			newmap[address.IP] = true
 			newlist = append(newlist, address.IP)
 		}
@@ -87,6 +104,22 @@ func (s *serviceMonitor) setAddresses(ep *corev1.Endpoints) {
 
 	s.backendsmap = newmap
 	s.backendslist = newlist
+	s.ports = newports
+
+	for _, ch := range s.notify {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Notify registers a channel notified of backend changes
+func (s *serviceMonitor) Notify(ch chan<- struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.notify = append(s.notify, ch)
 }
 
 func (s *serviceMonitor) getPool() (backends []string) {
@@ -139,7 +172,7 @@ func (s *serviceMonitor) GetBackend(ctx context.Context) (string, error) {
 	backends := s.getPool()
 
 	if len(backends) == 0 {
-		return "", errNoAvailableBackends
+		return "", pool.ErrNoBackends
 	}
 
 	return backends[rand.Intn(len(backends))], nil
@@ -152,3 +185,11 @@ func (s *serviceMonitor) IsBackendAlive(ctx context.Context, backend string) (bo
 
 	return s.backendsmap[backend], nil
 }
+
+// BackendPort returns the named endpoint port of a backend
+func (s *serviceMonitor) BackendPort(ctx context.Context, backend, name string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.ports[backend][name], nil
+}
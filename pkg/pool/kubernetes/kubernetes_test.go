@@ -0,0 +1,81 @@
+/*
+Copyright (c) Richard Kojedzinszky <richard@kojedz.in>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+ 1. Redistributions of source code must retain the above copyright
+    notice, this list of conditions and the following disclaimer.
+ 2. Redistributions in binary form must reproduce the above copyright
+    notice, this list of conditions and the following disclaimer in the
+    documentation and/or other materials provided with the distribution.
+ 3. Neither the name of the University nor the names of its contributors
+    may be used to endorse or promote products derived from this software
+    without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE REGENTS AND CONTRIBUTORS “AS IS” AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ARE DISCLAIMED.  IN NO EVENT SHALL THE REGENTS OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS
+OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT
+LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY
+OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF
+SUCH DAMAGE.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetAddresses(t *testing.T) {
+	s := &serviceMonitor{}
+	s.setAddresses(&corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+				Ports:     []corev1.EndpointPort{{Name: "imap", Port: 143}, {Port: 24}},
+			},
+			{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:     []corev1.EndpointPort{{Name: "lmtp", Port: 24}},
+			},
+		},
+	})
+
+	// addresses listed in several subsets keep their weight in GetBackend
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}; !slices.Equal(s.getPool(), want) {
+		t.Errorf("got pool %v, want %v", s.getPool(), want)
+	}
+
+	tests := []struct {
+		backend string
+		name    string
+		port    int
+		alive   bool
+	}{
+		{backend: "10.0.0.1", name: "imap", port: 143, alive: true},
+		{backend: "10.0.0.1", name: "lmtp", port: 24, alive: true},
+		{backend: "10.0.0.2", name: "imap", port: 143, alive: true},
+		{backend: "10.0.0.2", name: "lmtp", alive: true},
+		{backend: "10.0.0.3", name: "imap"},
+	}
+
+	for _, tt := range tests {
+		alive, _ := s.IsBackendAlive(context.Background(), tt.backend)
+		port, _ := s.BackendPort(context.Background(), tt.backend, tt.name)
+
+		if alive != tt.alive || port != tt.port {
+			t.Errorf("%s %s: got alive=%v port=%d", tt.backend, tt.name, alive, port)
+		}
+	}
+}
@@ -29,7 +29,13 @@ SUCH DAMAGE.
 
 package pool
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoBackends is returned when no backend is available
+var ErrNoBackends = errors.New("no backends are available")
 
 // Pool monitors backends
 type Pool interface {
@@ -42,3 +48,17 @@ type Pool interface {
 	// IsBackendAlive returns whether a given backend is available
 	IsBackendAlive(context.Context, string) (bool, error)
 }
+
+// Ports is implemented by pools knowing the ports backends listen on
+type Ports interface {
+	// BackendPort returns the port named after a service on a backend, or
+	// 0 if it is unknown
+	BackendPort(context.Context, string, string) (int, error)
+}
+
+// Notifier is implemented by pools signalling changes of their backends
+type Notifier interface {
+	// Notify makes the pool send on the channel after its backends have
+	// changed, without blocking
+	Notify(chan<- struct{})
+}